@@ -2,9 +2,12 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
@@ -12,6 +15,7 @@ import (
 
 	"github.com/alisaviation/monitoring/internal/agent/collector"
 	"github.com/alisaviation/monitoring/internal/agent/sender"
+	"github.com/alisaviation/monitoring/internal/agent/spool"
 	"github.com/alisaviation/monitoring/internal/config"
 	"github.com/alisaviation/monitoring/internal/logger"
 	"github.com/alisaviation/monitoring/internal/models"
@@ -36,40 +40,166 @@ func main() {
 		cancel()
 	}()
 
-	collectorInstance := collector.NewCollector()
-	senderInstance := sender.NewSender(conf.ServerAddress)
+	registry, err := newRegistry(conf)
+	if err != nil {
+		logger.Log.Fatal("Failed to configure collectors", zap.Error(err))
+	}
+	logger.Log.Info("Collectors enabled", zap.Strings("collectors", registry.Enabled()))
+
+	var senderInstance sender.MetricsSender
+	switch conf.Transport {
+	case config.TransportGRPC:
+		senderInstance, err = sender.NewGRPCSender(conf)
+	case config.TransportHTTP:
+		senderInstance, err = sender.NewSender(conf)
+	default:
+		err = fmt.Errorf("unknown transport %q", conf.Transport)
+	}
+	if err != nil {
+		logger.Log.Fatal("Failed to create sender", zap.Error(err))
+	}
+	defer senderInstance.Close()
+
+	var spoolInstance *spool.Spool
+	if conf.SpoolDir != "" {
+		spoolInstance, err = spool.Open(conf.SpoolDir, conf.SpoolMaxSize)
+		if err != nil {
+			logger.Log.Fatal("Failed to open spool", zap.Error(err))
+		}
+		logger.Log.Info("Spool opened", zap.String("dir", conf.SpoolDir), zap.Int("segments", spoolInstance.Len()))
+	}
+
 	metricsBuffer := make(map[string]*models.Metric)
+	jobs := make(chan map[string]*models.Metric, conf.RateLimit)
+	failed := make(chan map[string]*models.Metric, conf.RateLimit)
+
+	var wg sync.WaitGroup
+	for i := 0; i < conf.RateLimit; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			sendWorker(ctx, id, senderInstance, spoolInstance, jobs, failed)
+		}(i)
+	}
+
+	collected := make(chan map[string]*models.Metric, 1)
+	go registry.Run(ctx, collected)
 
-	pollTicker := time.NewTicker(conf.PollInterval)
 	reportTicker := time.NewTicker(conf.ReportInterval)
-	defer pollTicker.Stop()
 	defer reportTicker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			logger.Log.Info("Shutting down agent...")
+			close(jobs)
+			go func() {
+				wg.Wait()
+				close(failed)
+			}()
+			for batch := range failed {
+				collector.RestoreMetricsBuffer(metricsBuffer, batch)
+			}
 			if len(metricsBuffer) > 0 {
-				if err := senderInstance.SendMetricsBatch(ctx, metricsBuffer); err != nil {
+				shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), conf.ReportInterval)
+				if err := senderInstance.SendMetricsBatch(shutdownCtx, metricsBuffer); err != nil {
 					logger.Log.Error("Failed to send final metrics batch", zap.Error(err))
+					spoolBatch(spoolInstance, metricsBuffer)
 				}
+				shutdownCancel()
 			}
 			return
 
-		case <-pollTicker.C:
-			metrics := collectorInstance.CollectMetrics()
+		case metrics := <-collected:
 			collector.UpdateMetricsBuffer(metricsBuffer, metrics)
 			logger.Log.Debug("Collected metrics", zap.Int("count", len(metrics)))
 
+		case batch := <-failed:
+			collector.RestoreMetricsBuffer(metricsBuffer, batch)
+
 		case <-reportTicker.C:
-			if len(metricsBuffer) > 0 {
-				if err := senderInstance.SendMetricsBatch(ctx, metricsBuffer); err != nil {
-					logger.Log.Error("Failed to send metrics batch", zap.Error(err))
-					continue
-				}
-				logger.Log.Debug("Metrics batch sent", zap.Int("count", len(metricsBuffer)))
+			if len(metricsBuffer) == 0 {
+				continue
+			}
+			select {
+			case jobs <- collector.CopyMetrics(metricsBuffer):
 				metricsBuffer = make(map[string]*models.Metric)
+			default:
+				logger.Log.Warn("All send workers are busy, keeping metrics buffered",
+					zap.Int("count", len(metricsBuffer)))
 			}
 		}
 	}
 }
+
+func sendWorker(ctx context.Context, id int, senderInstance sender.MetricsSender, spoolInstance *spool.Spool, jobs <-chan map[string]*models.Metric, failed chan<- map[string]*models.Metric) {
+	for batch := range jobs {
+		if spoolInstance != nil {
+			if err := spoolInstance.Replay(ctx, replaySender(senderInstance)); err != nil {
+				logger.Log.Warn("Failed to replay spooled batches", zap.Int("worker", id), zap.Error(err))
+				if !spoolBatch(spoolInstance, batch) {
+					failed <- batch
+				}
+				continue
+			}
+		}
+
+		if err := senderInstance.SendMetricsBatch(ctx, batch); err != nil {
+			logger.Log.Error("Failed to send metrics batch", zap.Int("worker", id), zap.Error(err))
+			if errors.Is(err, sender.ErrRejected) {
+				continue
+			}
+			if !spoolBatch(spoolInstance, batch) {
+				failed <- batch
+			}
+			continue
+		}
+		logger.Log.Debug("Metrics batch sent", zap.Int("worker", id), zap.Int("count", len(batch)))
+	}
+}
+
+// replaySender drops batches the server rejects instead of replaying them forever.
+func replaySender(senderInstance sender.MetricsSender) spool.SendFunc {
+	return func(ctx context.Context, batch map[string]*models.Metric) error {
+		err := senderInstance.SendMetricsBatch(ctx, batch)
+		if errors.Is(err, sender.ErrRejected) {
+			return fmt.Errorf("%w: %v", spool.ErrDiscard, err)
+		}
+		return err
+	}
+}
+
+func spoolBatch(spoolInstance *spool.Spool, batch map[string]*models.Metric) bool {
+	if spoolInstance == nil {
+		return false
+	}
+	if err := spoolInstance.Append(batch); err != nil {
+		logger.Log.Error("Failed to spool metrics batch", zap.Error(err))
+		return false
+	}
+	logger.Log.Info("Metrics batch spooled to disk", zap.Int("count", len(batch)))
+	return true
+}
+
+func newRegistry(conf config.Agent) (*collector.Registry, error) {
+	registry := collector.NewRegistry()
+	for _, c := range []collector.Collector{
+		collector.NewRuntimeCollector(),
+		collector.NewSystemCollector(),
+		collector.NewDiskCollector(conf.DiskPaths),
+		collector.NewNetworkCollector(),
+	} {
+		if err := registry.Register(c, conf.PollInterval); err != nil {
+			return nil, err
+		}
+	}
+	for name, interval := range conf.CollectorIntervals {
+		if err := registry.SetInterval(name, interval); err != nil {
+			return nil, err
+		}
+	}
+	if err := registry.EnableOnly(conf.Collectors); err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
@@ -2,34 +2,56 @@ package main
 
 import (
 	"context"
+	"crypto/rsa"
 	"database/sql"
 	"flag"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	_ "github.com/lib/pq"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
 
+	"github.com/alisaviation/monitoring/internal/alerting"
 	"github.com/alisaviation/monitoring/internal/config"
+	"github.com/alisaviation/monitoring/internal/encryption"
+	"github.com/alisaviation/monitoring/internal/graphite"
 	"github.com/alisaviation/monitoring/internal/helpers"
 	"github.com/alisaviation/monitoring/internal/logger"
 	"github.com/alisaviation/monitoring/internal/middleware"
+	pb "github.com/alisaviation/monitoring/internal/proto"
+	"github.com/alisaviation/monitoring/internal/scrape"
 	"github.com/alisaviation/monitoring/internal/server"
+	"github.com/alisaviation/monitoring/internal/statsd"
 	"github.com/alisaviation/monitoring/internal/storage"
 )
 
+const (
+	walSnapshotInterval = 300 * time.Second
+	maxSweepInterval    = time.Minute
+)
+
 func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	conf := config.SetConfigServer()
 	if len(flag.Args()) > 0 {
-		log.Fatalf("Unknown flags: %v", flag.Args())
+		if flag.Arg(0) != "migrate" {
+			log.Fatalf("Unknown flags: %v", flag.Args())
+		}
+		if err := runMigrate(ctx, conf, flag.Args()[1:]); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
 	}
 
 	if err := logger.Initialize("info"); err != nil {
@@ -55,19 +77,37 @@ func main() {
 		}
 	} else {
 		memStorage := storage.NewMemStorage(conf.FileStoragePath)
+		memStorage.SetHistorySize(conf.HistorySize)
+		memStorage.SetSnapshotRetention(conf.SnapshotKeep)
+		defer memStorage.Close()
+
+		if conf.WALPath != "" {
+			if err := memStorage.EnableWAL(conf.WALPath); err != nil {
+				logger.Log.Fatal("Failed to open write-ahead log", zap.Error(err))
+			}
+			logger.Log.Info("Write-ahead log enabled", zap.String("path", conf.WALPath))
+		}
 
 		if conf.Restore {
 			if err := memStorage.Load(); err != nil {
 				logger.Log.Info("Could not load metrics from file", zap.Error(err))
 			} else {
-				logger.Log.Info("Metrics loaded from file", zap.String("path", conf.FileStoragePath))
+				logger.Log.Info("Metrics loaded from file", zap.String("path", memStorage.LoadedFrom()))
+			}
+		} else if conf.WALPath != "" {
+			if err := memStorage.Save(); err != nil {
+				logger.Log.Fatal("Failed to reset write-ahead log", zap.Error(err))
 			}
 		}
 
 		storageInstance = memStorage
 
-		if conf.StoreInterval > 0 {
-			saveTicker := time.NewTicker(conf.StoreInterval)
+		snapshotInterval := conf.StoreInterval
+		if snapshotInterval == 0 && conf.WALPath != "" {
+			snapshotInterval = walSnapshotInterval
+		}
+		if snapshotInterval > 0 {
+			saveTicker := time.NewTicker(snapshotInterval)
 			go func() {
 				for range saveTicker.C {
 					if err := memStorage.Save(); err != nil {
@@ -82,19 +122,149 @@ func main() {
 		}
 	}
 
+	// Everything writing to storage in the background stops before the final save.
+	var listeners sync.WaitGroup
+	listenersCtx, stopListeners := context.WithCancel(ctx)
+
+	srvr := server.NewServer(storageInstance, db)
+	srvr.MetricsLabels = conf.MetricsLabels
+	srvr.StaleAfter = conf.StaleTTL
+
+	if conf.RulesFile != "" {
+		rules, err := alerting.LoadRules(conf.RulesFile)
+		if err != nil {
+			logger.Log.Fatal("Failed to load alerting rules", zap.Error(err))
+		}
+		srvr.Alerts = alerting.NewEngine(storageInstance, rules)
+		listeners.Add(1)
+		go func() {
+			defer listeners.Done()
+			srvr.Alerts.Run(listenersCtx, conf.AlertInterval)
+		}()
+		logger.Log.Info("Alerting rules loaded", zap.Int("count", len(rules)))
+	}
+
+	if conf.ScrapeConfig != "" {
+		targets, err := scrape.LoadTargets(conf.ScrapeConfig, conf.ScrapeInterval)
+		if err != nil {
+			logger.Log.Fatal("Failed to load scrape targets", zap.Error(err))
+		}
+		srvr.Scrape = scrape.NewManager(srvr.StoreCumulative, targets)
+		listeners.Add(1)
+		go func() {
+			defer listeners.Done()
+			srvr.Scrape.Run(listenersCtx)
+		}()
+		logger.Log.Info("Scrape targets loaded", zap.Int("count", len(targets)))
+	}
+
+	if conf.ExpireTTL > 0 || conf.SampleRetention > 0 {
+		interval := maxSweepInterval
+		if conf.ExpireTTL > 0 {
+			interval = min(conf.ExpireTTL, interval)
+		}
+		if conf.SampleRetention > 0 {
+			interval = min(conf.SampleRetention, interval)
+		}
+		listeners.Add(1)
+		go func() {
+			defer listeners.Done()
+			srvr.RunSweeper(listenersCtx, conf.ExpireTTL, conf.SampleRetention, interval)
+		}()
+		logger.Log.Info("Sweeper started", zap.Duration("ttl", conf.ExpireTTL), zap.Duration("retention", conf.SampleRetention))
+	}
+
+	var trustedSubnet *net.IPNet
+	if conf.TrustedSubnet != "" {
+		var err error
+		_, trustedSubnet, err = net.ParseCIDR(conf.TrustedSubnet)
+		if err != nil {
+			logger.Log.Fatal("Invalid trusted subnet", zap.Error(err))
+		}
+	}
+
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
 	srv := &http.Server{Addr: conf.ServerAddress}
 	go func() {
-		if err := run(storageInstance, srv, conf.StoreInterval, db); err != nil && err != http.ErrServerClosed {
+		if err := run(srvr, srv, conf, trustedSubnet); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Error running server: %v", err)
 		}
 	}()
 	logger.Log.Info("Server started", zap.String("address", conf.ServerAddress))
 
+	if conf.StatsDAddress != "" {
+		conn, err := net.ListenPacket("udp", conf.StatsDAddress)
+		if err != nil {
+			logger.Log.Fatal("Failed to start StatsD listener", zap.Error(err))
+		}
+		statsdServer := statsd.NewServer(storageInstance, conf.StatsDFlushInterval, conf.StatsDTimerBuckets)
+		statsdServer.TrustedSubnet = trustedSubnet
+		listeners.Add(1)
+		go func() {
+			defer listeners.Done()
+			if err := statsdServer.Serve(listenersCtx, conn); err != nil {
+				logger.Log.Error("StatsD listener stopped", zap.Error(err))
+			}
+		}()
+		logger.Log.Info("StatsD listener started", zap.String("address", conf.StatsDAddress))
+	}
+	if conf.GraphiteAddress != "" {
+		templates, err := graphite.ParseTemplates(conf.GraphiteTemplates)
+		if err != nil {
+			logger.Log.Fatal("Invalid Graphite templates", zap.Error(err))
+		}
+		ln, err := net.Listen("tcp", conf.GraphiteAddress)
+		if err != nil {
+			logger.Log.Fatal("Failed to start Graphite listener", zap.Error(err))
+		}
+		graphiteServer := graphite.NewServer(storageInstance, templates)
+		graphiteServer.TrustedSubnet = trustedSubnet
+		graphiteServer.MaxConnections = conf.GraphiteMaxConnections
+		graphiteServer.IdleTimeout = conf.GraphiteIdleTimeout
+		listeners.Add(1)
+		go func() {
+			defer listeners.Done()
+			if err := graphiteServer.Serve(listenersCtx, ln); err != nil {
+				logger.Log.Error("Graphite listener stopped", zap.Error(err))
+			}
+		}()
+		logger.Log.Info("Graphite listener started", zap.String("address", conf.GraphiteAddress))
+	}
+
+	var grpcServer *grpc.Server
+	if conf.GRPCAddress != "" {
+		if conf.Key != "" || conf.CryptoKey != "" {
+			logger.Log.Fatal("gRPC does not support request signing or encryption, unset KEY and CRYPTO_KEY or GRPC_ADDRESS")
+		}
+		interceptors := []grpc.UnaryServerInterceptor{server.TrustedSubnetInterceptor(trustedSubnet)}
+		if conf.WALPath == "" {
+			interceptors = append(interceptors, server.SyncSaveInterceptor(conf.StoreInterval, srvr.Storage))
+		}
+		grpcServer = grpc.NewServer(grpc.ChainUnaryInterceptor(interceptors...))
+		go func() {
+			if err := runGRPC(srvr, grpcServer, conf.GRPCAddress); err != nil {
+				log.Fatalf("Error running gRPC server: %v", err)
+			}
+		}()
+		logger.Log.Info("gRPC server started", zap.String("address", conf.GRPCAddress))
+	}
+
 	<-done
 	logger.Log.Info("Server is shutting down...")
+
+	// Stop accepting writes before the final save so no request lands after it.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Log.Error("Server shutdown failed", zap.Error(err))
+	}
+	if grpcServer != nil {
+		grpcServer.GracefulStop()
+	}
+	stopListeners()
+	listeners.Wait()
 	if db != nil {
 		if err := db.Close(); err != nil {
 			logger.Log.Error("Failed to close database connection", zap.Error(err))
@@ -109,33 +279,72 @@ func main() {
 			}
 		}
 	}
+	logger.Log.Info("Server stopped")
+}
 
-	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := srv.Shutdown(ctx); err != nil {
-		logger.Log.Error("Server shutdown failed", zap.Error(err))
+func run(srvr *server.Server, srv *http.Server, conf config.Server, trustedSubnet *net.IPNet) error {
+	var privateKey *rsa.PrivateKey
+	if conf.CryptoKey != "" {
+		var err error
+		privateKey, err = encryption.LoadPrivateKey(conf.CryptoKey)
+		if err != nil {
+			return fmt.Errorf("failed to load private key: %w", err)
+		}
 	}
-	logger.Log.Info("Server stopped")
+
+	srv.Handler = newRouter(srvr, conf, trustedSubnet, privateKey)
+	return srv.ListenAndServe()
 }
 
-func run(storageInstance storage.Storage, srv *http.Server, storeInterval time.Duration, db *sql.DB) error {
-	srvr := server.NewServer(storageInstance, db)
+// newRouter builds the HTTP routes. Signing and encryption are only
+// understood by our own agent, so third-party ingestion and admin routes skip them.
+func newRouter(srvr *server.Server, conf config.Server, trustedSubnet *net.IPNet, privateKey *rsa.PrivateKey) chi.Router {
+	trusted := middleware.TrustedSubnetMiddleware(trustedSubnet)
+	trustedRemote := middleware.TrustedRemoteAddrMiddleware(trustedSubnet)
+	admin := middleware.AdminMiddleware(conf.AdminToken)
 
 	r := chi.NewRouter()
 	r.Use(logger.RequestResponseLogger)
-	r.Use(middleware.GzipMiddleware)
-	r.Use(middleware.SyncSaveMiddleware(storeInterval, storageInstance))
-
-	r.Post("/update/{type}/{name}/{value}", helpers.MethodCheck([]string{http.MethodPost})(srvr.UpdateMetrics))
-	r.Get("/value/{type}/{name}", helpers.MethodCheck([]string{http.MethodGet})(srvr.GetValue))
-	r.Post("/update/", helpers.MethodCheck([]string{http.MethodPost})(srvr.UpdateMetrics))
-	r.Get("/value/", helpers.MethodCheck([]string{http.MethodGet})(srvr.GetValue))
-	r.Post("/value/", helpers.MethodCheck([]string{http.MethodPost})(srvr.GetValue))
-	r.Get("/", helpers.MethodCheck([]string{http.MethodGet})(srvr.GetMetricsList))
-	r.Get("/ping", helpers.MethodCheck([]string{http.MethodGet})(srvr.PingHandler))
-	r.Post("/updates/", helpers.MethodCheck([]string{http.MethodPost})(srvr.UpdateBatchMetrics))
-
-	srv.Handler = r
-	return srv.ListenAndServe()
+	if conf.WALPath == "" {
+		r.Use(middleware.SyncSaveMiddleware(conf.StoreInterval, srvr.Storage))
+	}
+
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.DecryptMiddleware(privateKey))
+		r.Use(middleware.GzipMiddleware)
+		r.Use(middleware.HashMiddleware(conf.Key))
+
+		r.With(trusted).Post("/update/{type}/{name}/{value}", helpers.MethodCheck([]string{http.MethodPost})(srvr.UpdateMetrics))
+		r.Get("/value/{type}/{name}", helpers.MethodCheck([]string{http.MethodGet})(srvr.GetValue))
+		r.With(admin).Delete("/value/{type}/{name}", helpers.MethodCheck([]string{http.MethodDelete})(srvr.DeleteValue))
+		r.With(trusted).Post("/update/", helpers.MethodCheck([]string{http.MethodPost})(srvr.UpdateMetrics))
+		r.Get("/value/", helpers.MethodCheck([]string{http.MethodGet})(srvr.GetValue))
+		r.Post("/value/", helpers.MethodCheck([]string{http.MethodPost})(srvr.GetValue))
+		r.Get("/", helpers.MethodCheck([]string{http.MethodGet})(srvr.GetMetricsList))
+		r.Get("/ping", helpers.MethodCheck([]string{http.MethodGet})(srvr.PingHandler))
+		r.With(trusted).Post("/updates/", helpers.MethodCheck([]string{http.MethodPost})(srvr.UpdateBatchMetrics))
+		r.Get("/metrics", helpers.MethodCheck([]string{http.MethodGet})(srvr.PrometheusMetrics))
+		r.Get("/api/query_range", helpers.MethodCheck([]string{http.MethodGet})(srvr.QueryRange))
+		r.Get("/api/alerts", helpers.MethodCheck([]string{http.MethodGet})(srvr.GetAlerts))
+		r.Get("/api/targets", helpers.MethodCheck([]string{http.MethodGet})(srvr.GetTargets))
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.GzipMiddleware)
+
+		r.With(trustedRemote).Post("/api/v2/write", helpers.MethodCheck([]string{http.MethodPost})(srvr.WriteInflux))
+		r.With(trustedRemote).Post("/v1/metrics", helpers.MethodCheck([]string{http.MethodPost})(srvr.ReceiveOTLP))
+		r.With(trustedRemote).Post("/api/v1/write", helpers.MethodCheck([]string{http.MethodPost})(srvr.RemoteWrite))
+		r.With(admin).Post("/api/admin/delete", helpers.MethodCheck([]string{http.MethodPost})(srvr.DeleteMetrics))
+	})
+	return r
+}
+
+func runGRPC(srvr *server.Server, grpcServer *grpc.Server, address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	pb.RegisterMetricsServer(grpcServer, server.NewGRPCServer(srvr))
+	return grpcServer.Serve(listener)
 }
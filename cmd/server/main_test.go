@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/require"
+
+	"github.com/alisaviation/monitoring/internal/config"
+	"github.com/alisaviation/monitoring/internal/helpers"
+	"github.com/alisaviation/monitoring/internal/logger"
+	"github.com/alisaviation/monitoring/internal/server"
+	"github.com/alisaviation/monitoring/internal/storage"
+)
+
+func Test_newRouterSigningScope(t *testing.T) {
+	require.NoError(t, logger.Initialize("error"))
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	conf := config.Server{Key: "secret", AdminToken: "token", StoreInterval: time.Minute}
+	router := newRouter(server.NewServer(storage.NewMemStorage(""), nil), conf, nil, privateKey)
+
+	tests := []struct {
+		name         string
+		url          string
+		body         string
+		expectedCode int
+	}{
+		{"Agent Batch Requires Signature", "/updates/", `[{"id":"HeapAlloc","type":"gauge","value":1}]`, http.StatusBadRequest},
+		{"Influx Write", "/api/v2/write", "cpu usage=1", http.StatusNoContent},
+		{"OTLP Export", "/v1/metrics", `{"resourceMetrics":[]}`, http.StatusOK},
+		{"Admin Delete", "/api/admin/delete", `{"prefix":"cpu"}`, http.StatusOK},
+		{"Remote Write", "/api/v1/write", string(snappy.Encode(nil, nil)), http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.url, bytes.NewReader([]byte(tt.body)))
+			req.Header.Set("Authorization", "Bearer token")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			require.Equal(t, tt.expectedCode, w.Code, w.Body.String())
+		})
+	}
+}
+
+func Test_newRouterTrustedSubnet(t *testing.T) {
+	require.NoError(t, logger.Initialize("error"))
+	_, subnet, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+
+	conf := config.Server{StoreInterval: time.Minute}
+	router := newRouter(server.NewServer(storage.NewMemStorage(""), nil), conf, subnet, nil)
+
+	tests := []struct {
+		name         string
+		url          string
+		body         string
+		remoteAddr   string
+		realIP       string
+		expectedCode int
+	}{
+		{"Third-Party Write In Subnet", "/api/v2/write", "cpu usage=1", "10.1.2.3:5000", "", http.StatusNoContent},
+		{"Third-Party Write Outside Subnet", "/api/v2/write", "cpu usage=1", "192.0.2.1:5000", "10.1.2.3", http.StatusForbidden},
+		{"OTLP Export In Subnet", "/v1/metrics", `{"resourceMetrics":[]}`, "10.1.2.3:5000", "", http.StatusOK},
+		{"Agent Update Uses Real IP", "/update/", `{"id":"HeapAlloc","type":"gauge","value":1}`, "192.0.2.1:5000", "10.1.2.3", http.StatusOK},
+		{"Agent Update Without Real IP", "/update/", `{"id":"HeapAlloc","type":"gauge","value":1}`, "10.1.2.3:5000", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.url, bytes.NewReader([]byte(tt.body)))
+			req.RemoteAddr = tt.remoteAddr
+			if tt.realIP != "" {
+				req.Header.Set(helpers.RealIPHeader, tt.realIP)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			require.Equal(t, tt.expectedCode, w.Code, w.Body.String())
+		})
+	}
+}
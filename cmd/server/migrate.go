@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/alisaviation/monitoring/internal/config"
+	"github.com/alisaviation/monitoring/internal/storage"
+)
+
+const migrateUsage = "usage: server [flags] migrate [up [version] | down [steps] | status]"
+
+func runMigrate(ctx context.Context, conf config.Server, args []string) error {
+	if conf.DatabaseDSN == "" {
+		return errors.New("database DSN is required for migrations")
+	}
+
+	db, err := sql.Open("postgres", conf.DatabaseDSN)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := db.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	command := "up"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+	if len(args) > 1 {
+		return errors.New(migrateUsage)
+	}
+	number := 0
+	if len(args) == 1 {
+		number, err = strconv.Atoi(args[0])
+		if err != nil || number <= 0 {
+			return fmt.Errorf("invalid argument %q: %s", args[0], migrateUsage)
+		}
+	}
+
+	switch command {
+	case "up":
+		if err := storage.MigrateUp(ctx, db, number); err != nil {
+			return err
+		}
+	case "down":
+		if number == 0 {
+			number = 1
+		}
+		if err := storage.MigrateDown(ctx, db, number); err != nil {
+			return err
+		}
+	case "status":
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	statuses, err := storage.MigrationStatuses(ctx, db)
+	if err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		state := "pending"
+		if status.Applied {
+			state = "applied"
+		}
+		fmt.Printf("%04d_%s\t%s\n", status.Version, status.Name, state)
+	}
+	return nil
+}
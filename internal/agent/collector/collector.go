@@ -17,13 +17,13 @@ func (r *RealMemStatsReader) ReadMemStats(ms *runtime.MemStats) {
 	runtime.ReadMemStats(ms)
 }
 
-type Collector struct {
+type RuntimeCollector struct {
 	metrics map[string]*models.Metric
 	reader  MemStatsReader
 }
 
-func NewCollector() *Collector {
-	c := &Collector{
+func NewRuntimeCollector() *RuntimeCollector {
+	c := &RuntimeCollector{
 		metrics: make(map[string]*models.Metric),
 		reader:  &RealMemStatsReader{},
 	}
@@ -31,7 +31,7 @@ func NewCollector() *Collector {
 	return c
 }
 
-func (c *Collector) initMetrics() {
+func (c *RuntimeCollector) initMetrics() {
 	c.metrics[models.Alloc] = &models.Metric{ID: models.Alloc, Value: new(float64), MType: models.Gauge}
 	c.metrics[models.BuckHashSys] = &models.Metric{ID: models.BuckHashSys, Value: new(float64), MType: models.Gauge}
 	c.metrics[models.Frees] = &models.Metric{ID: models.Frees, Value: new(float64), MType: models.Gauge}
@@ -64,7 +64,15 @@ func (c *Collector) initMetrics() {
 	c.metrics[models.PollCount] = &models.Metric{ID: models.PollCount, Delta: new(int64), MType: models.Counter}
 }
 
-func (c *Collector) CollectMetrics() map[string]*models.Metric {
+func (c *RuntimeCollector) Name() string {
+	return SourceRuntime
+}
+
+func (c *RuntimeCollector) Collect() (map[string]*models.Metric, error) {
+	return c.CollectMetrics(), nil
+}
+
+func (c *RuntimeCollector) CollectMetrics() map[string]*models.Metric {
 	var memStats runtime.MemStats
 	c.reader.ReadMemStats(&memStats)
 
@@ -107,17 +115,82 @@ func UpdateMetricsBuffer(metricsBuffer map[string]*models.Metric, metrics map[st
 		if metric.MType == models.Counter {
 			if existingMetric, exists := metricsBuffer[name]; exists {
 				metricsBuffer[name] = &models.Metric{
-					ID:    existingMetric.ID,
-					Value: existingMetric.Value,
-					Delta: new(int64),
-					MType: existingMetric.MType,
+					ID:     existingMetric.ID,
+					Value:  existingMetric.Value,
+					Delta:  new(int64),
+					MType:  existingMetric.MType,
+					Labels: existingMetric.Labels,
 				}
 				*metricsBuffer[name].Delta = *existingMetric.Delta + *metric.Delta
 			} else {
 				metricsBuffer[name] = metric
 			}
+		} else if metric.MType == models.Histogram {
+			metricsBuffer[name] = mergeHistogramMetric(metricsBuffer[name], metric)
 		} else {
 			metricsBuffer[name] = metric
 		}
 	}
 }
+
+// Histograms carry observations since the last report, so buffered and new buckets are added together.
+func mergeHistogramMetric(existing, metric *models.Metric) *models.Metric {
+	if existing == nil || existing.Histogram == nil || metric.Histogram == nil {
+		return metric
+	}
+	histogram := existing.Histogram.Clone()
+	histogram.Merge(*metric.Histogram)
+	return &models.Metric{
+		ID:        existing.ID,
+		MType:     existing.MType,
+		Histogram: &histogram,
+		Labels:    existing.Labels,
+	}
+}
+
+func RestoreMetricsBuffer(metricsBuffer map[string]*models.Metric, failed map[string]*models.Metric) {
+	for name, metric := range failed {
+		existingMetric, exists := metricsBuffer[name]
+		if !exists {
+			metricsBuffer[name] = metric
+			continue
+		}
+		if metric.MType == models.Counter && existingMetric.Delta != nil && metric.Delta != nil {
+			delta := *existingMetric.Delta + *metric.Delta
+			metricsBuffer[name] = &models.Metric{
+				ID:     existingMetric.ID,
+				MType:  existingMetric.MType,
+				Delta:  &delta,
+				Labels: existingMetric.Labels,
+			}
+		}
+		if metric.MType == models.Histogram {
+			metricsBuffer[name] = mergeHistogramMetric(metric, existingMetric)
+		}
+	}
+}
+
+func CopyMetrics(metrics map[string]*models.Metric) map[string]*models.Metric {
+	copied := make(map[string]*models.Metric, len(metrics))
+	for name, metric := range metrics {
+		m := *metric
+		if metric.Value != nil {
+			value := *metric.Value
+			m.Value = &value
+		}
+		if metric.Delta != nil {
+			delta := *metric.Delta
+			m.Delta = &delta
+		}
+		if metric.Histogram != nil {
+			histogram := metric.Histogram.Clone()
+			m.Histogram = &histogram
+		}
+		if metric.Summary != nil {
+			summary := metric.Summary.Clone()
+			m.Summary = &summary
+		}
+		copied[name] = &m
+	}
+	return copied
+}
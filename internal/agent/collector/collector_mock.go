@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"os"
 	"runtime"
 )
 
@@ -37,3 +38,15 @@ func (m *MockMemStatsReader) ReadMemStats(ms *runtime.MemStats) {
 		TotalAlloc:    26000,
 	}
 }
+
+type MockProcReader struct {
+	Files map[string]string
+}
+
+func (m *MockProcReader) ReadFile(name string) ([]byte, error) {
+	data, ok := m.Files[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return []byte(data), nil
+}
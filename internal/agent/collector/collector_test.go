@@ -1,14 +1,17 @@
 package collector
 
 import (
+	"context"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/alisaviation/monitoring/internal/models"
 )
 
 func TestCollectMetrics(t *testing.T) {
 	mockReader := &MockMemStatsReader{}
-	c := &Collector{
+	c := &RuntimeCollector{
 		metrics: make(map[string]*models.Metric),
 		reader:  mockReader,
 	}
@@ -222,6 +225,260 @@ func TestUpdateMetricsBuffer(t *testing.T) {
 	}
 }
 
+func TestRestoreMetricsBuffer(t *testing.T) {
+	metricsBuffer := map[string]*models.Metric{
+		models.Alloc:     {ID: models.Alloc, Value: float64Ptr(2000), MType: models.Gauge},
+		models.PollCount: {ID: models.PollCount, Delta: int64Ptr(2), MType: models.Counter},
+	}
+	failed := map[string]*models.Metric{
+		models.Alloc:       {ID: models.Alloc, Value: float64Ptr(1000), MType: models.Gauge},
+		models.PollCount:   {ID: models.PollCount, Delta: int64Ptr(3), MType: models.Counter},
+		models.RandomValue: {ID: models.RandomValue, Value: float64Ptr(0.5), MType: models.Gauge},
+	}
+
+	RestoreMetricsBuffer(metricsBuffer, failed)
+
+	if *metricsBuffer[models.Alloc].Value != 2000 {
+		t.Errorf("Newer gauge value was overwritten: got %v", *metricsBuffer[models.Alloc].Value)
+	}
+	if *metricsBuffer[models.PollCount].Delta != 5 {
+		t.Errorf("Counter deltas were not merged: got %d", *metricsBuffer[models.PollCount].Delta)
+	}
+	if *metricsBuffer[models.RandomValue].Value != 0.5 {
+		t.Errorf("Missing gauge was not restored: got %v", *metricsBuffer[models.RandomValue].Value)
+	}
+}
+
+func TestLabeledCounterMetricsBuffer(t *testing.T) {
+	labels := map[string]string{"iface": "eth0"}
+	metricsBuffer := make(map[string]*models.Metric)
+	for i := 0; i < 3; i++ {
+		UpdateMetricsBuffer(metricsBuffer, map[string]*models.Metric{
+			`BytesSent{iface="eth0"}`: {ID: "BytesSent", Delta: int64Ptr(2), MType: models.Counter, Labels: labels},
+		})
+	}
+
+	metric := metricsBuffer[`BytesSent{iface="eth0"}`]
+	if *metric.Delta != 6 {
+		t.Errorf("Labeled counter deltas were not merged: got %d", *metric.Delta)
+	}
+	if metric.Labels["iface"] != "eth0" {
+		t.Errorf("Labeled counter lost its labels: got %v", metric.Labels)
+	}
+}
+
+func TestHistogramMetricsBuffer(t *testing.T) {
+	first := models.NewHistogram([]float64{0.1, 1})
+	first.Observe(0.05)
+	first.Observe(0.5)
+	second := models.NewHistogram([]float64{0.1, 1})
+	second.Observe(2)
+
+	metricsBuffer := make(map[string]*models.Metric)
+	UpdateMetricsBuffer(metricsBuffer, map[string]*models.Metric{
+		"latency": {ID: "latency", MType: models.Histogram, Histogram: first},
+	})
+	UpdateMetricsBuffer(metricsBuffer, map[string]*models.Metric{
+		"latency": {ID: "latency", MType: models.Histogram, Histogram: second},
+	})
+
+	histogram := metricsBuffer["latency"].Histogram
+	if histogram.Count != 3 || histogram.Sum != 2.55 {
+		t.Errorf("Histogram totals were not merged: count %d, sum %v", histogram.Count, histogram.Sum)
+	}
+	if histogram.Buckets[0].Count != 1 || histogram.Buckets[1].Count != 2 {
+		t.Errorf("Histogram buckets were not merged: %+v", histogram.Buckets)
+	}
+	if first.Count != 2 {
+		t.Errorf("Collector-owned histogram was modified: count %d", first.Count)
+	}
+
+	failed := CopyMetrics(metricsBuffer)
+	RestoreMetricsBuffer(metricsBuffer, failed)
+	if metricsBuffer["latency"].Histogram.Count != 6 {
+		t.Errorf("Failed histogram was not restored: count %d", metricsBuffer["latency"].Histogram.Count)
+	}
+
+	summary := &models.SummaryValue{Quantiles: []models.Quantile{{Quantile: 0.5, Value: 1}}, Sum: 3, Count: 3}
+	UpdateMetricsBuffer(metricsBuffer, map[string]*models.Metric{
+		"rpc": {ID: "rpc", MType: models.Summary, Summary: summary},
+	})
+	if metricsBuffer["rpc"].Summary.Count != 3 {
+		t.Errorf("Summary was not stored: %+v", metricsBuffer["rpc"].Summary)
+	}
+}
+
+func TestCopyMetrics(t *testing.T) {
+	metrics := map[string]*models.Metric{
+		models.Alloc:     {ID: models.Alloc, Value: float64Ptr(1000), MType: models.Gauge},
+		models.PollCount: {ID: models.PollCount, Delta: int64Ptr(1), MType: models.Counter},
+	}
+
+	copied := CopyMetrics(metrics)
+	*metrics[models.Alloc].Value = 2000
+	*metrics[models.PollCount].Delta = 2
+
+	if *copied[models.Alloc].Value != 1000 {
+		t.Errorf("Copied gauge changed with the source: got %v", *copied[models.Alloc].Value)
+	}
+	if *copied[models.PollCount].Delta != 1 {
+		t.Errorf("Copied counter changed with the source: got %d", *copied[models.PollCount].Delta)
+	}
+}
+
+func TestSystemCollectMetrics(t *testing.T) {
+	reader := &MockProcReader{Files: map[string]string{
+		"meminfo": "MemTotal:        2048 kB\nMemFree:         1024 kB\nMemAvailable:    1536 kB\n",
+		"stat":    "cpu  200 0 100 700 0 0 0 0 0 0\ncpu0 100 0 50 350 0 0 0 0 0 0\ncpu1 100 0 50 350 0 0 0 0 0 0\nintr 1 2 3\n",
+		"loadavg": "0.50 0.25 0.10 2/73 12024\n",
+	}}
+	c := &SystemCollector{
+		metrics: make(map[string]*models.Metric),
+		reader:  reader,
+		prevCPU: make(map[int]cpuTimes),
+	}
+
+	metrics, err := c.CollectMetrics()
+	if err != nil {
+		t.Fatalf("CollectMetrics failed: %v", err)
+	}
+
+	expected := map[string]float64{
+		models.TotalMemory:   2048 * 1024,
+		models.FreeMemory:    1024 * 1024,
+		"CPUutilization1":    30,
+		"CPUutilization2":    30,
+		models.LoadAverage1:  0.5,
+		models.LoadAverage5:  0.25,
+		models.LoadAverage15: 0.1,
+	}
+	for name, value := range expected {
+		metric, exists := metrics[name]
+		if !exists {
+			t.Errorf("Metric %s not found", name)
+			continue
+		}
+		if *metric.Value != value {
+			t.Errorf("Invalid metric value %s: expected %v, got %v", name, value, *metric.Value)
+		}
+	}
+
+	reader.Files["stat"] = "cpu  0 0 0 0 0 0 0 0 0 0\ncpu0 190 0 60 350 0 0 0 0 0 0\ncpu1 100 0 50 450 0 0 0 0 0 0\n"
+	metrics, err = c.CollectMetrics()
+	if err != nil {
+		t.Fatalf("CollectMetrics failed: %v", err)
+	}
+	if *metrics["CPUutilization1"].Value != 100 {
+		t.Errorf("Expected CPUutilization1 100, got %v", *metrics["CPUutilization1"].Value)
+	}
+	if *metrics["CPUutilization2"].Value != 0 {
+		t.Errorf("Expected CPUutilization2 0, got %v", *metrics["CPUutilization2"].Value)
+	}
+
+	// Guest time is already part of user time; a counter going backwards is skipped.
+	reader.Files["stat"] = "cpu  0 0 0 0 0 0 0 0 0 0\ncpu0 200 0 60 440 0 0 0 0 10 0\ncpu1 90 0 50 450 0 0 0 0 0 0\n"
+	metrics, err = c.CollectMetrics()
+	if err != nil {
+		t.Fatalf("CollectMetrics failed: %v", err)
+	}
+	if *metrics["CPUutilization1"].Value != 10 {
+		t.Errorf("Expected CPUutilization1 10, got %v", *metrics["CPUutilization1"].Value)
+	}
+	if *metrics["CPUutilization2"].Value != 0 {
+		t.Errorf("Expected CPUutilization2 to stay 0, got %v", *metrics["CPUutilization2"].Value)
+	}
+
+	delete(reader.Files, "loadavg")
+	if _, err := c.CollectMetrics(); err == nil {
+		t.Error("Expected error when loadavg is missing")
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	calls := make(map[string]int)
+	var mu sync.Mutex
+	newSource := func(name string) Collector {
+		return NewFuncCollector(name, func() (map[string]*models.Metric, error) {
+			mu.Lock()
+			calls[name]++
+			mu.Unlock()
+			value := 1.0
+			return map[string]*models.Metric{name: {ID: name, MType: models.Gauge, Value: &value}}, nil
+		})
+	}
+
+	if err := registry.Register(newSource("custom"), 5*time.Millisecond); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if err := registry.Register(newSource("disabled"), 5*time.Millisecond); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if err := registry.Register(newSource("custom"), time.Second); err == nil {
+		t.Error("Expected error on duplicate registration")
+	}
+	if err := registry.EnableOnly([]string{"custom"}); err != nil {
+		t.Fatalf("EnableOnly failed: %v", err)
+	}
+	if err := registry.Enable("unknown"); err == nil {
+		t.Error("Expected error when enabling unknown collector")
+	}
+	if enabled := registry.Enabled(); len(enabled) != 1 || enabled[0] != "custom" {
+		t.Errorf("Unexpected enabled collectors: %v", enabled)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out := make(chan map[string]*models.Metric)
+	done := make(chan struct{})
+	go func() {
+		registry.Run(ctx, out)
+		close(done)
+	}()
+
+	metrics := <-out
+	if _, exists := metrics["custom"]; !exists {
+		t.Errorf("Expected metrics from custom collector, got %v", metrics)
+	}
+	cancel()
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	if calls["disabled"] != 0 {
+		t.Errorf("Disabled collector was called %d times", calls["disabled"])
+	}
+}
+
+func TestNetworkCollect(t *testing.T) {
+	reader := &MockProcReader{Files: map[string]string{
+		"net/dev": "Inter-|   Receive |  Transmit\n face |bytes packets errs drop fifo frame compressed multicast|bytes packets\n" +
+			"  eth0: 1000 10 0 0 0 0 0 0 500 5 0 0 0 0 0 0\n",
+	}}
+	c := &NetworkCollector{reader: reader, prev: make(map[string]interfaceBytes)}
+
+	metrics, err := c.Collect()
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	if len(metrics) != 0 {
+		t.Errorf("Expected no metrics on first collection, got %d", len(metrics))
+	}
+
+	reader.Files["net/dev"] = "  eth0: 1500 15 0 0 0 0 0 0 800 8 0 0 0 0 0 0\n"
+	metrics, err = c.Collect()
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	received := metrics[models.SeriesKey(models.NetworkBytesReceived, map[string]string{"interface": "eth0"})]
+	sent := metrics[models.SeriesKey(models.NetworkBytesSent, map[string]string{"interface": "eth0"})]
+	if received == nil || *received.Delta != 500 {
+		t.Errorf("Unexpected received metric: %+v", received)
+	}
+	if sent == nil || *sent.Delta != 300 {
+		t.Errorf("Unexpected sent metric: %+v", sent)
+	}
+}
+
 // Helper functions to create pointers to float64 and int64
 func float64Ptr(v float64) *float64 {
 	return &v
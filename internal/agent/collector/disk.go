@@ -0,0 +1,48 @@
+package collector
+
+import (
+	"fmt"
+	"syscall"
+
+	"github.com/alisaviation/monitoring/internal/models"
+)
+
+type DiskCollector struct {
+	paths []string
+}
+
+func NewDiskCollector(paths []string) *DiskCollector {
+	if len(paths) == 0 {
+		paths = []string{"/"}
+	}
+	return &DiskCollector{paths: paths}
+}
+
+func (c *DiskCollector) Name() string {
+	return SourceDisk
+}
+
+func (c *DiskCollector) Collect() (map[string]*models.Metric, error) {
+	metrics := make(map[string]*models.Metric)
+	for _, path := range c.paths {
+		var stat syscall.Statfs_t
+		if err := syscall.Statfs(path, &stat); err != nil {
+			return nil, fmt.Errorf("statfs %s: %w", path, err)
+		}
+
+		blockSize := uint64(stat.Bsize)
+		total := float64(stat.Blocks * blockSize)
+		free := float64(stat.Bavail * blockSize)
+		labels := map[string]string{"path": path}
+
+		for name, value := range map[string]float64{
+			models.DiskTotal: total,
+			models.DiskFree:  free,
+			models.DiskUsed:  total - float64(stat.Bfree*blockSize),
+		} {
+			metric := &models.Metric{ID: name, MType: models.Gauge, Value: &value, Labels: labels}
+			metrics[metric.Key()] = metric
+		}
+	}
+	return metrics, nil
+}
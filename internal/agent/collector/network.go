@@ -0,0 +1,86 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alisaviation/monitoring/internal/models"
+)
+
+type interfaceBytes struct {
+	received uint64
+	sent     uint64
+}
+
+type NetworkCollector struct {
+	reader ProcReader
+	prev   map[string]interfaceBytes
+}
+
+func NewNetworkCollector() *NetworkCollector {
+	return &NetworkCollector{
+		reader: &RealProcReader{Root: "/proc"},
+		prev:   make(map[string]interfaceBytes),
+	}
+}
+
+func (c *NetworkCollector) Name() string {
+	return SourceNetwork
+}
+
+func (c *NetworkCollector) Collect() (map[string]*models.Metric, error) {
+	data, err := c.reader.ReadFile("net/dev")
+	if err != nil {
+		return nil, fmt.Errorf("read net/dev: %w", err)
+	}
+
+	metrics := make(map[string]*models.Metric)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		iface, stats, found := strings.Cut(scanner.Text(), ":")
+		if !found {
+			continue
+		}
+		iface = strings.TrimSpace(iface)
+		fields := strings.Fields(stats)
+		if len(fields) < 9 {
+			continue
+		}
+
+		received, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse net/dev %s: %w", iface, err)
+		}
+		sent, err := strconv.ParseUint(fields[8], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse net/dev %s: %w", iface, err)
+		}
+
+		current := interfaceBytes{received: received, sent: sent}
+		prev, seen := c.prev[iface]
+		c.prev[iface] = current
+		if !seen {
+			continue
+		}
+
+		labels := map[string]string{"interface": iface}
+		for name, delta := range map[string]int64{
+			models.NetworkBytesReceived: counterDelta(prev.received, current.received),
+			models.NetworkBytesSent:     counterDelta(prev.sent, current.sent),
+		} {
+			metric := &models.Metric{ID: name, MType: models.Counter, Delta: &delta, Labels: labels}
+			metrics[metric.Key()] = metric
+		}
+	}
+	return metrics, scanner.Err()
+}
+
+func counterDelta(prev, current uint64) int64 {
+	if current < prev {
+		return int64(current)
+	}
+	return int64(current - prev)
+}
@@ -0,0 +1,190 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/alisaviation/monitoring/internal/logger"
+	"github.com/alisaviation/monitoring/internal/models"
+)
+
+const (
+	SourceRuntime = "runtime"
+	SourceSystem  = "system"
+	SourceDisk    = "disk"
+	SourceNetwork = "network"
+)
+
+type Collector interface {
+	Name() string
+	Collect() (map[string]*models.Metric, error)
+}
+
+type FuncCollector struct {
+	name    string
+	collect func() (map[string]*models.Metric, error)
+}
+
+func NewFuncCollector(name string, collect func() (map[string]*models.Metric, error)) *FuncCollector {
+	return &FuncCollector{name: name, collect: collect}
+}
+
+func (f *FuncCollector) Name() string {
+	return f.name
+}
+
+func (f *FuncCollector) Collect() (map[string]*models.Metric, error) {
+	return f.collect()
+}
+
+type registryEntry struct {
+	collector Collector
+	interval  time.Duration
+	enabled   bool
+}
+
+type Registry struct {
+	entries map[string]*registryEntry
+	mu      sync.Mutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{entries: make(map[string]*registryEntry)}
+}
+
+func (r *Registry) Register(c Collector, interval time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.entries[c.Name()]; exists {
+		return fmt.Errorf("collector %q already registered", c.Name())
+	}
+	if interval <= 0 {
+		return fmt.Errorf("collector %q: interval must be positive", c.Name())
+	}
+	r.entries[c.Name()] = &registryEntry{collector: c, interval: interval, enabled: true}
+	return nil
+}
+
+func (r *Registry) SetInterval(name string, interval time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, exists := r.entries[name]
+	if !exists {
+		return fmt.Errorf("collector %q is not registered", name)
+	}
+	if interval <= 0 {
+		return fmt.Errorf("collector %q: interval must be positive", name)
+	}
+	entry.interval = interval
+	return nil
+}
+
+func (r *Registry) Enable(name string) error {
+	return r.setEnabled(name, true)
+}
+
+func (r *Registry) Disable(name string) error {
+	return r.setEnabled(name, false)
+}
+
+func (r *Registry) EnableOnly(names []string) error {
+	r.mu.Lock()
+	for _, entry := range r.entries {
+		entry.enabled = false
+	}
+	r.mu.Unlock()
+
+	for _, name := range names {
+		if err := r.Enable(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Registry) setEnabled(name string, enabled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, exists := r.entries[name]
+	if !exists {
+		return fmt.Errorf("collector %q is not registered", name)
+	}
+	entry.enabled = enabled
+	return nil
+}
+
+func (r *Registry) Enabled() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.entries))
+	for name, entry := range r.entries {
+		if entry.enabled {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *Registry) isEnabled(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, exists := r.entries[name]
+	return exists && entry.enabled
+}
+
+func (r *Registry) Run(ctx context.Context, out chan<- map[string]*models.Metric) {
+	r.mu.Lock()
+	entries := make([]registryEntry, 0, len(r.entries))
+	for _, entry := range r.entries {
+		entries = append(entries, *entry)
+	}
+	r.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, entry := range entries {
+		wg.Add(1)
+		go func(entry registryEntry) {
+			defer wg.Done()
+			r.runCollector(ctx, entry.collector, entry.interval, out)
+		}(entry)
+	}
+	wg.Wait()
+}
+
+func (r *Registry) runCollector(ctx context.Context, c Collector, interval time.Duration, out chan<- map[string]*models.Metric) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !r.isEnabled(c.Name()) {
+				continue
+			}
+			metrics, err := c.Collect()
+			if err != nil {
+				logger.Log.Warn("Failed to collect metrics",
+					zap.String("collector", c.Name()),
+					zap.Error(err))
+				continue
+			}
+			select {
+			case out <- CopyMetrics(metrics):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
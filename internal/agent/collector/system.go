@@ -0,0 +1,174 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/alisaviation/monitoring/internal/models"
+)
+
+type ProcReader interface {
+	ReadFile(name string) ([]byte, error)
+}
+
+type RealProcReader struct {
+	Root string
+}
+
+func (r *RealProcReader) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(r.Root, name))
+}
+
+type cpuTimes struct {
+	busy  uint64
+	total uint64
+}
+
+type SystemCollector struct {
+	metrics map[string]*models.Metric
+	reader  ProcReader
+	prevCPU map[int]cpuTimes
+}
+
+func NewSystemCollector() *SystemCollector {
+	return &SystemCollector{
+		metrics: make(map[string]*models.Metric),
+		reader:  &RealProcReader{Root: "/proc"},
+		prevCPU: make(map[int]cpuTimes),
+	}
+}
+
+func (c *SystemCollector) Name() string {
+	return SourceSystem
+}
+
+func (c *SystemCollector) Collect() (map[string]*models.Metric, error) {
+	return c.CollectMetrics()
+}
+
+func (c *SystemCollector) CollectMetrics() (map[string]*models.Metric, error) {
+	if err := c.collectMemory(); err != nil {
+		return nil, err
+	}
+	if err := c.collectCPU(); err != nil {
+		return nil, err
+	}
+	if err := c.collectLoad(); err != nil {
+		return nil, err
+	}
+	return c.metrics, nil
+}
+
+func (c *SystemCollector) setGauge(name string, value float64) {
+	metric, exists := c.metrics[name]
+	if !exists {
+		metric = &models.Metric{ID: name, Value: new(float64), MType: models.Gauge}
+		c.metrics[name] = metric
+	}
+	*metric.Value = value
+}
+
+func (c *SystemCollector) collectMemory() error {
+	data, err := c.reader.ReadFile("meminfo")
+	if err != nil {
+		return fmt.Errorf("read meminfo: %w", err)
+	}
+
+	fields := map[string]string{
+		"MemTotal": models.TotalMemory,
+		"MemFree":  models.FreeMemory,
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) < 2 {
+			continue
+		}
+		name, ok := fields[strings.TrimSuffix(parts[0], ":")]
+		if !ok {
+			continue
+		}
+		value, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return fmt.Errorf("parse meminfo %s: %w", parts[0], err)
+		}
+		if len(parts) > 2 && parts[2] == "kB" {
+			value *= 1024
+		}
+		c.setGauge(name, value)
+	}
+	return scanner.Err()
+}
+
+func (c *SystemCollector) collectCPU() error {
+	data, err := c.reader.ReadFile("stat")
+	if err != nil {
+		return fmt.Errorf("read stat: %w", err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) < 5 || !strings.HasPrefix(parts[0], "cpu") || parts[0] == "cpu" {
+			continue
+		}
+		core, err := strconv.Atoi(strings.TrimPrefix(parts[0], "cpu"))
+		if err != nil {
+			continue
+		}
+
+		var times cpuTimes
+		for i, field := range parts[1:] {
+			// guest and guest_nice are already counted in user and nice
+			if i >= 8 {
+				break
+			}
+			value, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return fmt.Errorf("parse stat %s: %w", parts[0], err)
+			}
+			times.total += value
+			// idle and iowait are the 4th and 5th columns
+			if i != 3 && i != 4 {
+				times.busy += value
+			}
+		}
+
+		prev := c.prevCPU[core]
+		c.prevCPU[core] = times
+		// Counters going backwards (e.g. a CPU brought back online) would underflow.
+		if times.total <= prev.total || times.busy < prev.busy {
+			continue
+		}
+		totalDelta := times.total - prev.total
+		utilization := float64(times.busy-prev.busy) / float64(totalDelta) * 100
+		c.setGauge(fmt.Sprintf("%s%d", models.CPUutilization, core+1), utilization)
+	}
+	return scanner.Err()
+}
+
+func (c *SystemCollector) collectLoad() error {
+	data, err := c.reader.ReadFile("loadavg")
+	if err != nil {
+		return fmt.Errorf("read loadavg: %w", err)
+	}
+
+	parts := strings.Fields(string(data))
+	if len(parts) < 3 {
+		return fmt.Errorf("unexpected loadavg format: %q", data)
+	}
+	names := []string{models.LoadAverage1, models.LoadAverage5, models.LoadAverage15}
+	for i, name := range names {
+		value, err := strconv.ParseFloat(parts[i], 64)
+		if err != nil {
+			return fmt.Errorf("parse loadavg: %w", err)
+		}
+		c.setGauge(name, value)
+	}
+	return nil
+}
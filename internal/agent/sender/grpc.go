@@ -0,0 +1,125 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/alisaviation/monitoring/internal/config"
+	"github.com/alisaviation/monitoring/internal/helpers"
+	"github.com/alisaviation/monitoring/internal/logger"
+	"github.com/alisaviation/monitoring/internal/models"
+	pb "github.com/alisaviation/monitoring/internal/proto"
+)
+
+type GRPCSender struct {
+	conn   *grpc.ClientConn
+	client pb.MetricsClient
+	labels map[string]string
+	realIP string
+}
+
+func NewGRPCSender(conf config.Agent) (*GRPCSender, error) {
+	if conf.Key != "" || conf.CryptoKey != "" {
+		return nil, errors.New("grpc transport does not support request signing or encryption")
+	}
+	conn, err := grpc.NewClient(conf.GRPCAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("grpc dial failed: %w", err)
+	}
+
+	s := &GRPCSender{
+		conn:   conn,
+		client: pb.NewMetricsClient(conn),
+		labels: conf.Labels,
+	}
+
+	realIP, err := outboundIP(conf.GRPCAddress)
+	if err != nil {
+		logger.Log.Warn("Failed to detect outbound IP", zap.Error(err))
+	} else {
+		s.realIP = realIP
+	}
+	return s, nil
+}
+
+func (s *GRPCSender) SendMetricsBatch(ctx context.Context, metrics map[string]*models.Metric) error {
+	if len(metrics) == 0 {
+		logger.Log.Warn("Error, the batch is empty")
+		return ErrEmptyBatch
+	}
+
+	req := &pb.UpdateMetricsRequest{}
+	for _, metric := range buildBatch(metrics, s.labels) {
+		if metric.MType != models.Gauge && metric.MType != models.Counter {
+			logger.Log.Warn("Metric type is not supported by gRPC transport, skipping",
+				zap.String("id", metric.ID), zap.String("type", metric.MType))
+			continue
+		}
+		req.Metrics = append(req.Metrics, &pb.Metric{
+			Id:     metric.ID,
+			Type:   metric.MType,
+			Delta:  metric.Delta,
+			Value:  metric.Value,
+			Labels: metric.Labels,
+		})
+	}
+
+	if s.realIP != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, helpers.RealIPMetadataKey, s.realIP)
+	}
+
+	retryDelays := [helpers.MaxRetries]time.Duration{helpers.InitialDelay, helpers.SecondDelay, helpers.ThirdDelay}
+	var lastErr error
+
+	for attempt := 0; attempt <= helpers.MaxRetries; attempt++ {
+		_, err := s.client.UpdateMetrics(ctx, req)
+		if err == nil {
+			return nil
+		}
+		if !isRetriableGRPCError(err) {
+			logger.Log.Error("Non-retriable gRPC error", zap.Error(err))
+			if status.Code(err) == codes.InvalidArgument {
+				return fmt.Errorf("%w: %v", ErrRejected, err)
+			}
+			return fmt.Errorf("%w: %v", ErrNonRetriable, err)
+		}
+
+		lastErr = err
+		logger.Log.Warn("Retriable gRPC error",
+			zap.Int("attempt", attempt+1),
+			zap.Error(err))
+
+		if attempt < helpers.MaxRetries {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(retryDelays[attempt]):
+			}
+		}
+	}
+
+	logger.Log.Error("Max retries exceeded", zap.Error(lastErr))
+	return fmt.Errorf("%w: last error: %v", ErrMaxRetriesExceeded, lastErr)
+}
+
+func (s *GRPCSender) Close() error {
+	return s.conn.Close()
+}
+
+func isRetriableGRPCError(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return true
+	default:
+		return false
+	}
+}
@@ -2,6 +2,7 @@ package sender
 
 import (
 	"context"
+	"crypto/rsa"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -10,23 +11,52 @@ import (
 	"github.com/go-resty/resty/v2"
 	"go.uber.org/zap"
 
+	"github.com/alisaviation/monitoring/internal/config"
+	"github.com/alisaviation/monitoring/internal/encryption"
 	"github.com/alisaviation/monitoring/internal/helpers"
 	"github.com/alisaviation/monitoring/internal/logger"
 	"github.com/alisaviation/monitoring/internal/models"
 )
 
+type MetricsSender interface {
+	SendMetricsBatch(ctx context.Context, metrics map[string]*models.Metric) error
+	Close() error
+}
+
 type Sender struct {
 	serverAddress string
+	labels        map[string]string
+	key           string
+	publicKey     *rsa.PublicKey
+	realIP        string
 	client        *resty.Client
 }
 
-func NewSender(serverAddress string) *Sender {
+func NewSender(conf config.Agent) (*Sender, error) {
 	client := resty.New()
 	client.SetHeader("Accept-Encoding", "gzip")
-	return &Sender{
-		serverAddress: serverAddress,
+	s := &Sender{
+		serverAddress: conf.ServerAddress,
+		labels:        conf.Labels,
+		key:           conf.Key,
 		client:        client,
 	}
+
+	if conf.CryptoKey != "" {
+		publicKey, err := encryption.LoadPublicKey(conf.CryptoKey)
+		if err != nil {
+			return nil, fmt.Errorf("load public key failed: %w", err)
+		}
+		s.publicKey = publicKey
+	}
+
+	realIP, err := outboundIP(conf.ServerAddress)
+	if err != nil {
+		logger.Log.Warn("Failed to detect outbound IP", zap.Error(err))
+	} else {
+		s.realIP = realIP
+	}
+	return s, nil
 }
 
 func (s *Sender) SendMetricsBatch(ctx context.Context, metrics map[string]*models.Metric) error {
@@ -35,20 +65,7 @@ func (s *Sender) SendMetricsBatch(ctx context.Context, metrics map[string]*model
 		return ErrEmptyBatch
 	}
 
-	metricsList := make([]models.Metric, 0, len(metrics))
-	for name, metric := range metrics {
-		batchMetrics := models.Metric{
-			ID:    name,
-			MType: metric.MType,
-		}
-		if metric.MType == models.Gauge {
-			batchMetrics.Value = metric.Value
-		}
-		if metric.MType == models.Counter {
-			batchMetrics.Delta = metric.Delta
-		}
-		metricsList = append(metricsList, batchMetrics)
-	}
+	metricsList := buildBatch(metrics, s.labels)
 
 	jsonData, err := json.Marshal(metricsList)
 	if err != nil {
@@ -92,6 +109,9 @@ func (s *Sender) sendWithRetry(ctx context.Context, endpoint string, data []byte
 				logger.Log.Error("Non-retriable error response",
 					zap.String("status", resp.Status()),
 					zap.Int("code", resp.StatusCode()))
+				if resp.StatusCode() >= http.StatusBadRequest && resp.StatusCode() < http.StatusInternalServerError {
+					return fmt.Errorf("%w: server returned status %d", ErrRejected, resp.StatusCode())
+				}
 				return fmt.Errorf("server returned status %d", resp.StatusCode())
 			}
 
@@ -126,3 +146,46 @@ func (s *Sender) sendWithRetry(ctx context.Context, endpoint string, data []byte
 	logger.Log.Error("Max retries exceeded", zap.Error(lastErr))
 	return fmt.Errorf("%w: last error: %v", ErrMaxRetriesExceeded, lastErr)
 }
+
+func (s *Sender) Close() error {
+	return nil
+}
+
+func buildBatch(metrics map[string]*models.Metric, labels map[string]string) []models.Metric {
+	metricsList := make([]models.Metric, 0, len(metrics))
+	for _, metric := range metrics {
+		batchMetrics := models.Metric{
+			ID:     metric.ID,
+			MType:  metric.MType,
+			Labels: mergeLabels(labels, metric.Labels),
+		}
+		if metric.MType == models.Gauge {
+			batchMetrics.Value = metric.Value
+		}
+		if metric.MType == models.Counter {
+			batchMetrics.Delta = metric.Delta
+		}
+		if metric.MType == models.Histogram {
+			batchMetrics.Histogram = metric.Histogram
+		}
+		if metric.MType == models.Summary {
+			batchMetrics.Summary = metric.Summary
+		}
+		metricsList = append(metricsList, batchMetrics)
+	}
+	return metricsList
+}
+
+func mergeLabels(common, own map[string]string) map[string]string {
+	if len(common) == 0 {
+		return own
+	}
+	labels := make(map[string]string, len(common)+len(own))
+	for k, v := range common {
+		labels[k] = v
+	}
+	for k, v := range own {
+		labels[k] = v
+	}
+	return labels
+}
@@ -5,6 +5,7 @@ import (
 	"compress/gzip"
 	"context"
 	"errors"
+	"fmt"
 	"net"
 	"net/http"
 
@@ -12,6 +13,7 @@ import (
 	"github.com/lib/pq"
 	"go.uber.org/zap"
 
+	"github.com/alisaviation/monitoring/internal/encryption"
 	"github.com/alisaviation/monitoring/internal/helpers"
 	"github.com/alisaviation/monitoring/internal/logger"
 )
@@ -67,6 +69,7 @@ var (
 	ErrMaxRetriesExceeded = errors.New("maximum retry attempts exceeded")
 	ErrNonRetriable       = errors.New("non-retriable error occurred")
 	ErrEmptyBatch         = errors.New("metrics batch is empty")
+	ErrRejected           = errors.New("metrics batch rejected by server")
 )
 
 func (s *Sender) prepareRequest(ctx context.Context, endpoint string, data []byte) (*resty.Request, error) {
@@ -76,9 +79,43 @@ func (s *Sender) prepareRequest(ctx context.Context, endpoint string, data []byt
 		return nil, err
 	}
 
-	return s.client.R().
+	req := s.client.R().
 		SetContext(ctx).
 		SetHeader("Content-Type", "application/json").
-		SetHeader("Content-Encoding", "gzip").
-		SetBody(compressedData), nil
+		SetHeader("Content-Encoding", "gzip")
+	if s.realIP != "" {
+		req.SetHeader(helpers.RealIPHeader, s.realIP)
+	}
+	if s.key != "" {
+		req.SetHeader(helpers.HashHeader, helpers.ComputeHash(data, s.key))
+	}
+
+	if s.publicKey == nil {
+		return req.SetBody(compressedData), nil
+	}
+
+	envelope, err := encryption.Encrypt(s.publicKey, compressedData)
+	if err != nil {
+		logger.Log.Error("Error encrypting data", zap.Error(err))
+		return nil, err
+	}
+	req.SetHeader(encryption.SchemeHeader, envelope.Scheme)
+	if envelope.EncryptedKey != "" {
+		req.SetHeader(encryption.KeyHeader, envelope.EncryptedKey)
+	}
+	return req.SetBody(envelope.Data), nil
+}
+
+func outboundIP(serverAddress string) (string, error) {
+	conn, err := net.Dial("udp", serverAddress)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	addr, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return "", fmt.Errorf("unexpected local address %v", conn.LocalAddr())
+	}
+	return addr.IP.String(), nil
 }
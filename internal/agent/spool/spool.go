@@ -0,0 +1,316 @@
+package spool
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/alisaviation/monitoring/internal/logger"
+	"github.com/alisaviation/monitoring/internal/models"
+)
+
+const (
+	DefaultSegmentSize = 1 << 20
+	segmentPrefix      = "segment-"
+	segmentSuffix      = ".log"
+)
+
+// ErrDiscard is returned by a SendFunc for batches that can never be delivered.
+var ErrDiscard = errors.New("batch discarded")
+
+type SendFunc func(ctx context.Context, batch map[string]*models.Metric) error
+
+type Spool struct {
+	dir         string
+	maxBytes    int64
+	segmentSize int64
+	segments    []string
+	sizes       map[string]int64
+	nextID      uint64
+	// replaying is the segment Replay is sending, which Append and evict leave alone.
+	replaying string
+	mu        sync.Mutex
+	replayMu  sync.Mutex
+}
+
+func Open(dir string, maxBytes int64) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create spool dir: %w", err)
+	}
+
+	s := &Spool{
+		dir:         dir,
+		maxBytes:    maxBytes,
+		segmentSize: DefaultSegmentSize,
+		sizes:       make(map[string]int64),
+	}
+	if maxBytes > 0 && maxBytes < s.segmentSize {
+		s.segmentSize = maxBytes
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read spool dir: %w", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		var id uint64
+		if _, err := fmt.Sscanf(strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentSuffix), "%d", &id); err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		s.segments = append(s.segments, name)
+		s.sizes[name] = info.Size()
+		if id >= s.nextID {
+			s.nextID = id + 1
+		}
+	}
+	sort.Strings(s.segments)
+	return s, nil
+}
+
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.segments)
+}
+
+func (s *Spool) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.totalSize()
+}
+
+func (s *Spool) totalSize() int64 {
+	var total int64
+	for _, size := range s.sizes {
+		total += size
+	}
+	return total
+}
+
+func (s *Spool) Append(batch map[string]*models.Metric) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.append(batch)
+}
+
+func (s *Spool) append(batch map[string]*models.Metric) error {
+	metrics := make([]models.Metric, 0, len(batch))
+	for _, metric := range batch {
+		metrics = append(metrics, *metric)
+	}
+	record, err := json.Marshal(metrics)
+	if err != nil {
+		return fmt.Errorf("marshal batch: %w", err)
+	}
+	record = append(record, '\n')
+
+	name := ""
+	if len(s.segments) > 0 {
+		last := s.segments[len(s.segments)-1]
+		if last != s.replaying && s.sizes[last]+int64(len(record)) <= s.segmentSize {
+			name = last
+		}
+	}
+	if name == "" {
+		name = fmt.Sprintf("%s%020d%s", segmentPrefix, s.nextID, segmentSuffix)
+		s.nextID++
+		s.segments = append(s.segments, name)
+		s.sizes[name] = 0
+	}
+
+	file, err := os.OpenFile(filepath.Join(s.dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(record); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	s.sizes[name] += int64(len(record))
+
+	return s.evict()
+}
+
+func (s *Spool) evict() error {
+	for s.maxBytes > 0 && s.totalSize() > s.maxBytes && len(s.segments) > 1 {
+		oldest := s.segments[0]
+		if oldest == s.replaying {
+			if len(s.segments) < 3 {
+				return nil
+			}
+			oldest = s.segments[1]
+		}
+		logger.Log.Warn("Spool size limit exceeded, dropping oldest segment",
+			zap.String("segment", oldest),
+			zap.Int64("size", s.sizes[oldest]))
+		if err := s.removeSegment(oldest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Spool) removeSegment(name string) error {
+	if err := os.Remove(filepath.Join(s.dir, name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i, segment := range s.segments {
+		if segment == name {
+			s.segments = append(s.segments[:i], s.segments[i+1:]...)
+			break
+		}
+	}
+	delete(s.sizes, name)
+	return nil
+}
+
+// Replay sends spooled batches oldest first. The spool stays unlocked during sends, so
+// Append does not wait on a slow server; new batches go to a fresh segment meanwhile.
+func (s *Spool) Replay(ctx context.Context, send SendFunc) error {
+	s.replayMu.Lock()
+	defer s.replayMu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.replaying = ""
+		s.mu.Unlock()
+	}()
+
+	for {
+		s.mu.Lock()
+		if len(s.segments) == 0 {
+			s.mu.Unlock()
+			return nil
+		}
+		name := s.segments[0]
+		s.replaying = name
+		records, err := s.readSegment(name)
+		s.mu.Unlock()
+		if err != nil {
+			return err
+		}
+
+		for i, record := range records {
+			batch, err := decodeRecord(record)
+			if err != nil {
+				logger.Log.Warn("Skipping corrupted spool record", zap.String("segment", name), zap.Error(err))
+				continue
+			}
+			err = send(ctx, batch)
+			if errors.Is(err, ErrDiscard) {
+				logger.Log.Error("Dropping spooled batch rejected by server", zap.String("segment", name), zap.Error(err))
+				continue
+			}
+			if err != nil {
+				s.mu.Lock()
+				rewriteErr := s.rewriteSegment(name, records[i:])
+				s.mu.Unlock()
+				if rewriteErr != nil {
+					return rewriteErr
+				}
+				return err
+			}
+		}
+
+		s.mu.Lock()
+		err = s.removeSegment(name)
+		s.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Spool) readSegment(name string) ([][]byte, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, name))
+	if err != nil {
+		return nil, err
+	}
+
+	var records [][]byte
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	for scanner.Scan() {
+		if line := scanner.Bytes(); len(line) > 0 {
+			records = append(records, append([]byte(nil), line...))
+		}
+	}
+	return records, scanner.Err()
+}
+
+func (s *Spool) rewriteSegment(name string, records [][]byte) error {
+	data := bytes.Join(records, []byte{'\n'})
+	data = append(data, '\n')
+
+	path := filepath.Join(s.dir, name)
+	tmp, err := os.CreateTemp(s.dir, name+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	if err := syncDir(s.dir); err != nil {
+		return err
+	}
+	s.sizes[name] = int64(len(data))
+	return nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func decodeRecord(record []byte) (map[string]*models.Metric, error) {
+	var metrics []models.Metric
+	if err := json.Unmarshal(record, &metrics); err != nil {
+		return nil, err
+	}
+	batch := make(map[string]*models.Metric, len(metrics))
+	for i := range metrics {
+		batch[metrics[i].Key()] = &metrics[i]
+	}
+	return batch, nil
+}
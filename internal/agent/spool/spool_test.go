@@ -0,0 +1,160 @@
+package spool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/alisaviation/monitoring/internal/models"
+)
+
+func TestAppendAndReplay(t *testing.T) {
+	s, err := Open(t.TempDir(), 0)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		id, value := fmt.Sprintf("m%d", i), float64(i)
+		require.NoError(t, s.Append(map[string]*models.Metric{id: {ID: id, MType: models.Gauge, Value: &value}}))
+	}
+	require.Equal(t, 1, s.Len())
+	require.Positive(t, s.Size())
+
+	var sent []string
+	err = s.Replay(context.Background(), func(ctx context.Context, batch map[string]*models.Metric) error {
+		for id := range batch {
+			sent = append(sent, id)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"m0", "m1", "m2"}, sent)
+	require.Equal(t, 0, s.Len())
+	require.Zero(t, s.Size())
+}
+
+func TestReplayPartialFailure(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, 0)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		id, value := fmt.Sprintf("m%d", i), float64(i)
+		require.NoError(t, s.Append(map[string]*models.Metric{id: {ID: id, MType: models.Gauge, Value: &value}}))
+	}
+
+	errUnavailable := errors.New("server unavailable")
+	calls := 0
+	err = s.Replay(context.Background(), func(ctx context.Context, batch map[string]*models.Metric) error {
+		calls++
+		if calls == 2 {
+			return errUnavailable
+		}
+		return nil
+	})
+	require.ErrorIs(t, err, errUnavailable)
+	require.Equal(t, 1, s.Len())
+
+	reopened, err := Open(dir, 0)
+	require.NoError(t, err)
+	require.Equal(t, s.Size(), reopened.Size())
+
+	var sent []string
+	err = reopened.Replay(context.Background(), func(ctx context.Context, batch map[string]*models.Metric) error {
+		for id := range batch {
+			sent = append(sent, id)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"m1", "m2"}, sent)
+}
+
+func TestReopenContinuesSegments(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, 0)
+	require.NoError(t, err)
+	s.segmentSize = 1
+	first := 1.0
+	require.NoError(t, s.Append(map[string]*models.Metric{"first": {ID: "first", MType: models.Gauge, Value: &first}}))
+
+	reopened, err := Open(dir, 0)
+	require.NoError(t, err)
+	reopened.segmentSize = 1
+	second := 2.0
+	require.NoError(t, reopened.Append(map[string]*models.Metric{"second": {ID: "second", MType: models.Gauge, Value: &second}}))
+	require.Equal(t, 2, reopened.Len())
+
+	var sent []string
+	err = reopened.Replay(context.Background(), func(ctx context.Context, batch map[string]*models.Metric) error {
+		for id := range batch {
+			sent = append(sent, id)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"first", "second"}, sent)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestAppendEvictsOldestSegments(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, 200)
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		id, value := fmt.Sprintf("m%d", i), float64(i)
+		require.NoError(t, s.Append(map[string]*models.Metric{id: {ID: id, MType: models.Gauge, Value: &value}}))
+	}
+	require.LessOrEqual(t, s.Size(), int64(200))
+
+	var sent []string
+	err = s.Replay(context.Background(), func(ctx context.Context, batch map[string]*models.Metric) error {
+		for id := range batch {
+			sent = append(sent, id)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, sent)
+	require.Less(t, len(sent), 10)
+	require.Equal(t, "m9", sent[len(sent)-1])
+
+	matches, err := filepath.Glob(filepath.Join(dir, segmentPrefix+"*"))
+	require.NoError(t, err)
+	require.Empty(t, matches)
+}
+
+func TestReplayDiscardsRejectedAndAllowsAppend(t *testing.T) {
+	s, err := Open(t.TempDir(), 0)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		id, value := fmt.Sprintf("m%d", i), float64(i)
+		require.NoError(t, s.Append(map[string]*models.Metric{id: {ID: id, MType: models.Gauge, Value: &value}}))
+	}
+
+	var sent []string
+	err = s.Replay(context.Background(), func(ctx context.Context, batch map[string]*models.Metric) error {
+		if _, ok := batch["m1"]; ok {
+			// Appending while a send is in flight must not block on the replay.
+			late := 3.0
+			require.NoError(t, s.Append(map[string]*models.Metric{"late": {ID: "late", MType: models.Gauge, Value: &late}}))
+			return fmt.Errorf("%w: bad request", ErrDiscard)
+		}
+		for id := range batch {
+			sent = append(sent, id)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"m0", "m2", "late"}, sent)
+	require.Equal(t, 0, s.Len())
+}
@@ -0,0 +1,197 @@
+package alerting
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/alisaviation/monitoring/internal/logger"
+	"github.com/alisaviation/monitoring/internal/storage"
+)
+
+const (
+	StatePending  = "pending"
+	StateFiring   = "firing"
+	StateResolved = "resolved"
+)
+
+type Alert struct {
+	Rule       string     `json:"rule"`
+	Expr       string     `json:"expr"`
+	State      string     `json:"state"`
+	Value      float64    `json:"value"`
+	Series     string     `json:"series,omitempty"`
+	ActiveAt   time.Time  `json:"active_at"`
+	FiredAt    *time.Time `json:"fired_at,omitempty"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+type sample struct {
+	value float64
+	at    time.Time
+}
+
+type Engine struct {
+	storage storage.Storage
+	rules   []Rule
+	alerts  map[string]*Alert
+	// last holds the previous counter sample per rule and series for rate().
+	last map[string]map[string]sample
+	mu   sync.Mutex
+}
+
+func NewEngine(storage storage.Storage, rules []Rule) *Engine {
+	return &Engine{
+		storage: storage,
+		rules:   rules,
+		alerts:  make(map[string]*Alert),
+		last:    make(map[string]map[string]sample),
+	}
+}
+
+func (e *Engine) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			e.Evaluate(ctx, now)
+		}
+	}
+}
+
+func (e *Engine) Evaluate(ctx context.Context, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	gauges, err := e.storage.Gauges(ctx)
+	if err != nil {
+		logger.Log.Error("Failed to read gauges for alerting", zap.Error(err))
+		return
+	}
+	counters, err := e.storage.Counters(ctx)
+	if err != nil {
+		logger.Log.Error("Failed to read counters for alerting", zap.Error(err))
+		return
+	}
+
+	for _, rule := range e.rules {
+		series, value, active := "", 0.0, false
+		for _, v := range e.values(rule, gauges, counters, now) {
+			if rule.matches(v.value) {
+				series, value, active = v.series, v.value, true
+				break
+			}
+		}
+		e.transition(rule, active, series, value, now)
+	}
+}
+
+type seriesValue struct {
+	series string
+	value  float64
+}
+
+// values returns the rule's value for every series it selects, ordered by series key.
+// The rule is active when any of them matches.
+func (e *Engine) values(rule Rule, gauges map[string]float64, counters map[string]int64, now time.Time) []seriesValue {
+	var values []seriesValue
+	if rule.Func == FuncRate {
+		prev := e.last[rule.Name]
+		current := make(map[string]sample)
+		for key, counter := range counters {
+			if !rule.selects(key) {
+				continue
+			}
+			value := float64(counter)
+			current[key] = sample{value: value, at: now}
+			last, seen := prev[key]
+			if !seen {
+				continue
+			}
+			elapsed := now.Sub(last.at).Seconds()
+			if elapsed <= 0 {
+				continue
+			}
+			delta := value - last.value
+			if delta < 0 {
+				delta = value
+			}
+			values = append(values, seriesValue{series: key, value: delta / elapsed})
+		}
+		e.last[rule.Name] = current
+	} else {
+		for key, gauge := range gauges {
+			if rule.selects(key) {
+				values = append(values, seriesValue{series: key, value: gauge})
+			}
+		}
+		for key, counter := range counters {
+			if rule.selects(key) {
+				values = append(values, seriesValue{series: key, value: float64(counter)})
+			}
+		}
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].series < values[j].series
+	})
+	return values
+}
+
+func (e *Engine) transition(rule Rule, active bool, series string, value float64, now time.Time) {
+	alert, exists := e.alerts[rule.Name]
+
+	if !active {
+		if exists && alert.State != StateResolved {
+			if alert.State == StateFiring {
+				alert.State = StateResolved
+				alert.ResolvedAt = &now
+				logger.Log.Info("Alert resolved", zap.String("rule", rule.Name))
+			} else {
+				delete(e.alerts, rule.Name)
+			}
+		}
+		return
+	}
+
+	if !exists || alert.State == StateResolved {
+		alert = &Alert{
+			Rule:     rule.Name,
+			Expr:     rule.Expr,
+			State:    StatePending,
+			ActiveAt: now,
+		}
+		e.alerts[rule.Name] = alert
+	}
+	alert.Value = value
+	alert.Series = series
+
+	if alert.State == StatePending && now.Sub(alert.ActiveAt) >= rule.For {
+		alert.State = StateFiring
+		alert.FiredAt = &now
+		logger.Log.Warn("Alert firing",
+			zap.String("rule", rule.Name),
+			zap.String("series", series),
+			zap.Float64("value", value))
+	}
+}
+
+func (e *Engine) Alerts() []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	alerts := make([]Alert, 0, len(e.alerts))
+	for _, alert := range e.alerts {
+		alerts = append(alerts, *alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].Rule < alerts[j].Rule
+	})
+	return alerts
+}
@@ -0,0 +1,165 @@
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/alisaviation/monitoring/internal/storage"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		name      string
+		expr      string
+		wantFunc  string
+		wantName  string
+		wantOp    string
+		wantValue float64
+		wantFor   time.Duration
+		wantErr   bool
+	}{
+		{"heap", "HeapAlloc > 500MB for 2m", "", "HeapAlloc", ">", 500 * (1 << 20), 2 * time.Minute, false},
+		{"poll", "rate(PollCount) == 0 for 1m", FuncRate, "PollCount", "==", 0, time.Minute, false},
+		{"random", "RandomValue >= 0.5", "", "RandomValue", ">=", 0.5, 0, false},
+		{"selector", `HeapAlloc{host="a"} > 1`, "", "HeapAlloc", ">", 1, 0, false},
+		{"no operator", "HeapAlloc 500", "", "", "", 0, 0, true},
+		{"bad selector", "HeapAlloc{host=a} > 1", "", "", "", 0, 0, true},
+		{"bad threshold", "HeapAlloc > lots", "", "", "", 0, 0, true},
+		{"bad duration", "HeapAlloc > 1 for soon", "", "", "", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := ParseRule(tt.name, tt.expr)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantFunc, rule.Func)
+			require.Equal(t, tt.wantName, rule.Metric)
+			require.Equal(t, tt.wantOp, rule.Op)
+			require.Equal(t, tt.wantValue, rule.Threshold)
+			require.Equal(t, tt.wantFor, rule.For)
+		})
+	}
+}
+
+func TestEngineEvaluate(t *testing.T) {
+	ctx := context.Background()
+	memStorage := storage.NewMemStorage("")
+
+	heap, err := ParseRule("HighHeap", "HeapAlloc > 100 for 2m")
+	require.NoError(t, err)
+	stalled, err := ParseRule("Stalled", "rate(PollCount) == 0 for 1m")
+	require.NoError(t, err)
+
+	engine := NewEngine(memStorage, []Rule{heap, stalled})
+	start := time.Now()
+
+	memStorage.SetGauge(ctx, "HeapAlloc", 200)
+	memStorage.AddCounter(ctx, "PollCount", 5)
+	engine.Evaluate(ctx, start)
+
+	alerts := engine.Alerts()
+	require.Len(t, alerts, 1)
+	require.Equal(t, "HighHeap", alerts[0].Rule)
+	require.Equal(t, StatePending, alerts[0].State)
+
+	engine.Evaluate(ctx, start.Add(time.Minute))
+	alerts = engine.Alerts()
+	require.Len(t, alerts, 2)
+	require.Equal(t, StatePending, alerts[0].State)
+	require.Equal(t, "Stalled", alerts[1].Rule)
+	require.Equal(t, StatePending, alerts[1].State)
+
+	memStorage.AddCounter(ctx, "PollCount", 1)
+	engine.Evaluate(ctx, start.Add(2*time.Minute))
+	alerts = engine.Alerts()
+	require.Len(t, alerts, 1)
+	require.Equal(t, StateFiring, alerts[0].State)
+
+	memStorage.SetGauge(ctx, "HeapAlloc", 50)
+	memStorage.AddCounter(ctx, "PollCount", 1)
+	engine.Evaluate(ctx, start.Add(3*time.Minute))
+	alerts = engine.Alerts()
+	require.Len(t, alerts, 1)
+	require.Equal(t, StateResolved, alerts[0].State)
+	require.NotNil(t, alerts[0].ResolvedAt)
+}
+
+func TestEngineRateRulesOnSameMetric(t *testing.T) {
+	ctx := context.Background()
+	memStorage := storage.NewMemStorage("")
+
+	busy, err := ParseRule("Busy", "rate(PollCount) > 0")
+	require.NoError(t, err)
+	flood, err := ParseRule("Flood", "rate(PollCount) > 0.01")
+	require.NoError(t, err)
+
+	engine := NewEngine(memStorage, []Rule{busy, flood})
+	start := time.Now()
+
+	memStorage.AddCounter(ctx, "PollCount", 1)
+	engine.Evaluate(ctx, start)
+	memStorage.AddCounter(ctx, "PollCount", 6)
+	engine.Evaluate(ctx, start.Add(time.Minute))
+
+	alerts := engine.Alerts()
+	require.Len(t, alerts, 2)
+	require.Equal(t, 0.1, alerts[0].Value)
+	require.Equal(t, 0.1, alerts[1].Value)
+}
+
+func TestEngineLabeledSeries(t *testing.T) {
+	ctx := context.Background()
+	memStorage := storage.NewMemStorage("")
+
+	anyHost, err := ParseRule("AnyHost", "HeapAlloc > 100")
+	require.NoError(t, err)
+	hostB, err := ParseRule("HostB", `HeapAlloc{host="b"} > 100`)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"host": "b"}, hostB.Labels)
+
+	engine := NewEngine(memStorage, []Rule{anyHost, hostB})
+	memStorage.SetGauge(ctx, `HeapAlloc{host="a"}`, 200)
+	memStorage.SetGauge(ctx, `HeapAlloc{host="b"}`, 50)
+	engine.Evaluate(ctx, time.Now())
+
+	alerts := engine.Alerts()
+	require.Len(t, alerts, 1)
+	require.Equal(t, "AnyHost", alerts[0].Rule)
+	require.Equal(t, `HeapAlloc{host="a"}`, alerts[0].Series)
+	require.Equal(t, 200.0, alerts[0].Value)
+}
+
+func TestEngineRunConcurrentWrites(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	memStorage := storage.NewMemStorage("")
+
+	heap, err := ParseRule("HighHeap", "HeapAlloc > 100")
+	require.NoError(t, err)
+	poll, err := ParseRule("Polling", "rate(PollCount) > 0")
+	require.NoError(t, err)
+
+	engine := NewEngine(memStorage, []Rule{heap, poll})
+	done := make(chan struct{})
+	go func() {
+		engine.Run(ctx, time.Millisecond)
+		close(done)
+	}()
+
+	for i := 0; i < 1000; i++ {
+		memStorage.SetGauge(ctx, fmt.Sprintf(`HeapAlloc{host="%d"}`, i%10), float64(i))
+		memStorage.AddCounter(ctx, fmt.Sprintf(`PollCount{host="%d"}`, i%10), 1)
+	}
+	cancel()
+	<-done
+
+	engine.Evaluate(context.Background(), time.Now())
+	require.NotEmpty(t, engine.Alerts())
+}
@@ -0,0 +1,152 @@
+package alerting
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alisaviation/monitoring/internal/models"
+)
+
+const (
+	FuncRate = "rate"
+)
+
+type Rule struct {
+	Name      string            `json:"name"`
+	Expr      string            `json:"expr"`
+	Func      string            `json:"-"`
+	Metric    string            `json:"-"`
+	Labels    map[string]string `json:"-"`
+	Op        string            `json:"-"`
+	Threshold float64           `json:"-"`
+	For       time.Duration     `json:"-"`
+}
+
+var operators = []string{">=", "<=", "==", "!=", ">", "<"}
+
+var units = map[string]float64{
+	"KB": 1 << 10,
+	"MB": 1 << 20,
+	"GB": 1 << 30,
+	"TB": 1 << 40,
+}
+
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to decode rules file: %w", err)
+	}
+
+	for i := range rules {
+		parsed, err := ParseRule(rules[i].Name, rules[i].Expr)
+		if err != nil {
+			return nil, err
+		}
+		rules[i] = parsed
+	}
+	return rules, nil
+}
+
+func ParseRule(name, expr string) (Rule, error) {
+	rule := Rule{Name: name, Expr: expr}
+	if name == "" {
+		return rule, fmt.Errorf("rule name is required")
+	}
+
+	body := strings.TrimSpace(expr)
+	if idx := strings.LastIndex(body, " for "); idx >= 0 {
+		duration, err := time.ParseDuration(strings.TrimSpace(body[idx+len(" for "):]))
+		if err != nil {
+			return rule, fmt.Errorf("rule %q: invalid for duration: %w", name, err)
+		}
+		rule.For = duration
+		body = strings.TrimSpace(body[:idx])
+	}
+
+	opIdx := -1
+	for _, op := range operators {
+		if idx := strings.Index(body, op); idx >= 0 {
+			opIdx = idx
+			rule.Op = op
+			break
+		}
+	}
+	if opIdx < 0 {
+		return rule, fmt.Errorf("rule %q: missing comparison operator", name)
+	}
+
+	left := strings.TrimSpace(body[:opIdx])
+	right := strings.TrimSpace(body[opIdx+len(rule.Op):])
+
+	if strings.HasPrefix(left, FuncRate+"(") && strings.HasSuffix(left, ")") {
+		rule.Func = FuncRate
+		left = strings.TrimSpace(left[len(FuncRate)+1 : len(left)-1])
+	}
+	metric, labels := models.ParseSeriesKey(left)
+	if metric == "" || strings.ContainsAny(metric, " (){}") {
+		return rule, fmt.Errorf("rule %q: invalid metric name %q", name, left)
+	}
+	rule.Metric = metric
+	rule.Labels = labels
+
+	threshold, err := parseThreshold(right)
+	if err != nil {
+		return rule, fmt.Errorf("rule %q: %w", name, err)
+	}
+	rule.Threshold = threshold
+
+	return rule, nil
+}
+
+func parseThreshold(s string) (float64, error) {
+	multiplier := 1.0
+	upper := strings.ToUpper(s)
+	for unit, m := range units {
+		if strings.HasSuffix(upper, unit) {
+			multiplier = m
+			s = strings.TrimSpace(s[:len(s)-len(unit)])
+			break
+		}
+	}
+
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid threshold %q", s)
+	}
+	return value * multiplier, nil
+}
+
+// selects reports whether the series key belongs to the rule's metric and carries
+// the labels of its selector, e.g. HeapAlloc{host="a"}.
+func (r Rule) selects(key string) bool {
+	metric, labels := models.ParseSeriesKey(key)
+	return metric == r.Metric && models.MatchLabels(labels, r.Labels)
+}
+
+func (r Rule) matches(value float64) bool {
+	switch r.Op {
+	case ">":
+		return value > r.Threshold
+	case ">=":
+		return value >= r.Threshold
+	case "<":
+		return value < r.Threshold
+	case "<=":
+		return value <= r.Threshold
+	case "==":
+		return value == r.Threshold
+	case "!=":
+		return value != r.Threshold
+	default:
+		return false
+	}
+}
@@ -3,14 +3,36 @@ package config
 import (
 	"flag"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/alisaviation/monitoring/internal/models"
+)
+
+const (
+	TransportHTTP = "http"
+	TransportGRPC = "grpc"
 )
 
 type Agent struct {
 	ServerAddress  string
 	PollInterval   time.Duration
 	ReportInterval time.Duration
+	Labels         map[string]string
+	Key            string
+	CryptoKey      string
+	Transport      string
+	GRPCAddress    string
+	RateLimit      int
+
+	Collectors         []string
+	CollectorIntervals map[string]time.Duration
+	DiskPaths          []string
+
+	SpoolDir     string
+	SpoolMaxSize int64
 }
 
 func SetConfigAgent() Agent {
@@ -22,11 +44,33 @@ func SetConfigAgent() Agent {
 	address := flag.String("a", "localhost:8080", "HTTP server address")
 	poll := flag.Int64("p", 2, "Poll interval in seconds")
 	report := flag.Int64("r", 10, "Report interval in seconds")
+	labels := flag.String("labels", "", "Labels attached to every metric, e.g. host=web1,service=api")
+	key := flag.String("k", "", "Key for HMAC-SHA256 request signing")
+	cryptoKey := flag.String("crypto-key", "", "Path to the server RSA public key (PEM)")
+	transport := flag.String("transport", TransportHTTP, "Transport used to send metrics: http or grpc")
+	grpcAddress := flag.String("grpc-address", "localhost:3200", "gRPC server address")
+	rateLimit := flag.Int("l", 1, "Maximum number of concurrent outgoing requests")
+	collectors := flag.String("collectors", "runtime,system", "Enabled collectors: runtime, system, disk, network")
+	collectorIntervals := flag.String("collector-intervals", "", "Per-collector poll intervals, e.g. system=5s,disk=30s")
+	diskPaths := flag.String("disk-paths", "/", "Comma-separated mount points for the disk collector")
+	spoolDir := flag.String("spool-dir", "", "Directory for unsent batches, disabled when empty")
+	spoolMaxSize := flag.Int64("spool-max-size", 100, "Maximum spool size in megabytes")
 
 	flag.Parse()
 	config.ServerAddress = *address
 	config.PollInterval = time.Duration(*poll) * time.Second
 	config.ReportInterval = time.Duration(*report) * time.Second
+	config.Labels = models.ParseLabels(*labels)
+	config.Key = *key
+	config.CryptoKey = *cryptoKey
+	config.Transport = *transport
+	config.GRPCAddress = *grpcAddress
+	config.RateLimit = *rateLimit
+	config.Collectors = splitList(*collectors)
+	config.CollectorIntervals = parseIntervals(*collectorIntervals)
+	config.DiskPaths = splitList(*diskPaths)
+	config.SpoolDir = *spoolDir
+	config.SpoolMaxSize = *spoolMaxSize << 20
 
 	if envAddress := os.Getenv("ADDRESS"); envAddress != "" {
 		config.ServerAddress = envAddress
@@ -41,6 +85,46 @@ func SetConfigAgent() Agent {
 			config.PollInterval = time.Duration(pollInterval) * time.Second
 		}
 	}
+	if envLabels := os.Getenv("LABELS"); envLabels != "" {
+		config.Labels = models.ParseLabels(envLabels)
+	}
+	if envKey := os.Getenv("KEY"); envKey != "" {
+		config.Key = envKey
+	}
+	if envCryptoKey := os.Getenv("CRYPTO_KEY"); envCryptoKey != "" {
+		config.CryptoKey = envCryptoKey
+	}
+	if envTransport := os.Getenv("TRANSPORT"); envTransport != "" {
+		config.Transport = envTransport
+	}
+	if envGRPCAddress := os.Getenv("GRPC_ADDRESS"); envGRPCAddress != "" {
+		config.GRPCAddress = envGRPCAddress
+	}
+	if envRateLimit := os.Getenv("RATE_LIMIT"); envRateLimit != "" {
+		if rateLimit, err := strconv.Atoi(envRateLimit); err == nil {
+			config.RateLimit = rateLimit
+		}
+	}
+	if config.RateLimit < 1 {
+		config.RateLimit = 1
+	}
+	if envCollectors := os.Getenv("COLLECTORS"); envCollectors != "" {
+		config.Collectors = splitList(envCollectors)
+	}
+	if envCollectorIntervals := os.Getenv("COLLECTOR_INTERVALS"); envCollectorIntervals != "" {
+		config.CollectorIntervals = parseIntervals(envCollectorIntervals)
+	}
+	if envDiskPaths := os.Getenv("DISK_PATHS"); envDiskPaths != "" {
+		config.DiskPaths = splitList(envDiskPaths)
+	}
+	if envSpoolDir := os.Getenv("SPOOL_DIR"); envSpoolDir != "" {
+		config.SpoolDir = envSpoolDir
+	}
+	if envSpoolMaxSize := os.Getenv("SPOOL_MAX_SIZE"); envSpoolMaxSize != "" {
+		if spoolMaxSize, err := strconv.ParseInt(envSpoolMaxSize, 10, 64); err == nil {
+			config.SpoolMaxSize = spoolMaxSize << 20
+		}
+	}
 
 	return config
 }
@@ -51,6 +135,32 @@ type Server struct {
 	FileStoragePath string
 	Restore         bool
 	DatabaseDSN     string
+	RulesFile       string
+	AlertInterval   time.Duration
+	HistorySize     int
+	SampleRetention time.Duration
+	StaleTTL        time.Duration
+	ExpireTTL       time.Duration
+	MetricsLabels   map[string]string
+	Key             string
+	CryptoKey       string
+	TrustedSubnet   string
+	AdminToken      string
+	GRPCAddress     string
+	WALPath         string
+	SnapshotKeep    int
+
+	StatsDAddress       string
+	StatsDFlushInterval time.Duration
+	StatsDTimerBuckets  []float64
+
+	GraphiteAddress        string
+	GraphiteTemplates      []string
+	GraphiteMaxConnections int
+	GraphiteIdleTimeout    time.Duration
+
+	ScrapeConfig   string
+	ScrapeInterval time.Duration
 }
 
 func SetConfigServer() Server {
@@ -60,12 +170,41 @@ func SetConfigServer() Server {
 	config.FileStoragePath = "metrics.json"
 	config.Restore = true
 	config.DatabaseDSN = ""
+	config.AlertInterval = 15 * time.Second
+	config.HistorySize = 3600
+	config.SampleRetention = 7 * 24 * time.Hour
+	config.SnapshotKeep = 3
+	config.GraphiteMaxConnections = 100
+	config.ScrapeInterval = 15 * time.Second
 
 	storeInt := flag.Int("i", 300, "Store interval in seconds")
 	filePath := flag.String("f", "metrics.json", "File storage path")
 	restore := flag.Bool("r", true, "Restore metrics from file")
 	address := flag.String("a", "localhost:8080", "HTTP server address")
 	databaseDSN := flag.String("d", "", "Database connection string (DSN)")
+	rulesFile := flag.String("rules", "", "Alerting rules file path")
+	alertInt := flag.Int("alert-interval", 15, "Alerting rules evaluation interval in seconds")
+	historySize := flag.Int("history-size", 3600, "Samples kept per series in memory storage")
+	sampleRetention := flag.Int("sample-retention", 604800, "Seconds samples are kept for range queries, disabled when 0")
+	staleTTL := flag.Int("stale-ttl", 0, "Seconds without updates after which a series is marked stale, disabled when 0")
+	expireTTL := flag.Int("expire-ttl", 0, "Seconds without updates after which a series is deleted, disabled when 0")
+	metricsLabels := flag.String("metrics-labels", "", "Labels added to /metrics output, e.g. env=prod,dc=eu")
+	key := flag.String("k", "", "Key for HMAC-SHA256 request verification")
+	cryptoKey := flag.String("crypto-key", "", "Path to the server RSA private key (PEM)")
+	trustedSubnet := flag.String("t", "", "Trusted agent subnet in CIDR notation")
+	adminToken := flag.String("admin-token", "", "Bearer token for admin endpoints, disabled when empty")
+	grpcAddress := flag.String("grpc-address", "", "gRPC server address, disabled when empty")
+	walPath := flag.String("wal", "", "Write-ahead log path for memory storage, disabled when empty")
+	snapshotKeep := flag.Int("snapshot-keep", 3, "Number of previous snapshots kept for recovery")
+	statsdAddress := flag.String("statsd-address", "", "StatsD UDP listen address, disabled when empty")
+	statsdFlushInt := flag.Int("statsd-flush-interval", 10, "StatsD timer flush interval in seconds")
+	statsdBuckets := flag.String("statsd-timer-buckets", "", "Comma-separated StatsD timer bucket bounds in milliseconds")
+	graphiteAddress := flag.String("graphite-address", "", "Graphite plaintext TCP listen address, disabled when empty")
+	graphiteTemplates := flag.String("graphite-templates", "", "Comma-separated Graphite path templates, e.g. \"servers.* .host.measurement*\"")
+	graphiteMaxConns := flag.Int("graphite-max-connections", 100, "Maximum concurrent Graphite connections, unlimited when 0")
+	scrapeConfig := flag.String("scrape-config", "", "Prometheus scrape targets file path, disabled when empty")
+	scrapeInt := flag.Int("scrape-interval", 15, "Default scrape interval in seconds")
+	graphiteIdleTimeout := flag.Int("graphite-idle-timeout", 300, "Seconds before an idle Graphite connection is closed, disabled when 0")
 
 	flag.Parse()
 
@@ -74,6 +213,29 @@ func SetConfigServer() Server {
 	config.FileStoragePath = *filePath
 	config.Restore = *restore
 	config.DatabaseDSN = *databaseDSN
+	config.RulesFile = *rulesFile
+	config.AlertInterval = time.Duration(*alertInt) * time.Second
+	config.HistorySize = *historySize
+	config.SampleRetention = time.Duration(*sampleRetention) * time.Second
+	config.StaleTTL = time.Duration(*staleTTL) * time.Second
+	config.ExpireTTL = time.Duration(*expireTTL) * time.Second
+	config.MetricsLabels = models.ParseLabels(*metricsLabels)
+	config.Key = *key
+	config.CryptoKey = *cryptoKey
+	config.TrustedSubnet = *trustedSubnet
+	config.AdminToken = *adminToken
+	config.GRPCAddress = *grpcAddress
+	config.WALPath = *walPath
+	config.SnapshotKeep = *snapshotKeep
+	config.StatsDAddress = *statsdAddress
+	config.StatsDFlushInterval = time.Duration(*statsdFlushInt) * time.Second
+	config.StatsDTimerBuckets = parseFloats(*statsdBuckets)
+	config.GraphiteAddress = *graphiteAddress
+	config.GraphiteTemplates = splitList(*graphiteTemplates)
+	config.GraphiteMaxConnections = *graphiteMaxConns
+	config.GraphiteIdleTimeout = time.Duration(*graphiteIdleTimeout) * time.Second
+	config.ScrapeConfig = *scrapeConfig
+	config.ScrapeInterval = time.Duration(*scrapeInt) * time.Second
 
 	if envAddress := os.Getenv("ADDRESS"); envAddress != "" {
 		config.ServerAddress = envAddress
@@ -94,6 +256,134 @@ func SetConfigServer() Server {
 	if envDatabaseDSN := os.Getenv("DATABASE_DSN"); envDatabaseDSN != "" {
 		config.DatabaseDSN = envDatabaseDSN
 	}
+	if envRulesFile := os.Getenv("RULES_FILE"); envRulesFile != "" {
+		config.RulesFile = envRulesFile
+	}
+	if envAlertInterval := os.Getenv("ALERT_INTERVAL"); envAlertInterval != "" {
+		if alertInterval, err := strconv.Atoi(envAlertInterval); err == nil {
+			config.AlertInterval = time.Duration(alertInterval) * time.Second
+		}
+	}
+	if envHistorySize := os.Getenv("HISTORY_SIZE"); envHistorySize != "" {
+		if size, err := strconv.Atoi(envHistorySize); err == nil {
+			config.HistorySize = size
+		}
+	}
+	if envSampleRetention := os.Getenv("SAMPLE_RETENTION"); envSampleRetention != "" {
+		if retention, err := strconv.Atoi(envSampleRetention); err == nil {
+			config.SampleRetention = time.Duration(retention) * time.Second
+		}
+	}
+	if envStaleTTL := os.Getenv("STALE_TTL"); envStaleTTL != "" {
+		if staleTTL, err := strconv.Atoi(envStaleTTL); err == nil {
+			config.StaleTTL = time.Duration(staleTTL) * time.Second
+		}
+	}
+	if envExpireTTL := os.Getenv("EXPIRE_TTL"); envExpireTTL != "" {
+		if expireTTL, err := strconv.Atoi(envExpireTTL); err == nil {
+			config.ExpireTTL = time.Duration(expireTTL) * time.Second
+		}
+	}
+	if envMetricsLabels := os.Getenv("METRICS_LABELS"); envMetricsLabels != "" {
+		config.MetricsLabels = models.ParseLabels(envMetricsLabels)
+	}
+	if envKey := os.Getenv("KEY"); envKey != "" {
+		config.Key = envKey
+	}
+	if envCryptoKey := os.Getenv("CRYPTO_KEY"); envCryptoKey != "" {
+		config.CryptoKey = envCryptoKey
+	}
+	if envTrustedSubnet := os.Getenv("TRUSTED_SUBNET"); envTrustedSubnet != "" {
+		config.TrustedSubnet = envTrustedSubnet
+	}
+	if envAdminToken := os.Getenv("ADMIN_TOKEN"); envAdminToken != "" {
+		config.AdminToken = envAdminToken
+	}
+	if envGRPCAddress := os.Getenv("GRPC_ADDRESS"); envGRPCAddress != "" {
+		config.GRPCAddress = envGRPCAddress
+	}
+	if envWALPath := os.Getenv("WAL_PATH"); envWALPath != "" {
+		config.WALPath = envWALPath
+	}
+	if envSnapshotKeep := os.Getenv("SNAPSHOT_KEEP"); envSnapshotKeep != "" {
+		if keep, err := strconv.Atoi(envSnapshotKeep); err == nil {
+			config.SnapshotKeep = keep
+		}
+	}
+	if envStatsDAddress := os.Getenv("STATSD_ADDRESS"); envStatsDAddress != "" {
+		config.StatsDAddress = envStatsDAddress
+	}
+	if envStatsDFlushInterval := os.Getenv("STATSD_FLUSH_INTERVAL"); envStatsDFlushInterval != "" {
+		if flushInterval, err := strconv.Atoi(envStatsDFlushInterval); err == nil {
+			config.StatsDFlushInterval = time.Duration(flushInterval) * time.Second
+		}
+	}
+	if envStatsDBuckets := os.Getenv("STATSD_TIMER_BUCKETS"); envStatsDBuckets != "" {
+		config.StatsDTimerBuckets = parseFloats(envStatsDBuckets)
+	}
+	if config.AlertInterval <= 0 {
+		config.AlertInterval = 15 * time.Second
+	}
+	if config.StatsDFlushInterval <= 0 {
+		config.StatsDFlushInterval = 10 * time.Second
+	}
+	if envGraphiteAddress := os.Getenv("GRAPHITE_ADDRESS"); envGraphiteAddress != "" {
+		config.GraphiteAddress = envGraphiteAddress
+	}
+	if envGraphiteTemplates := os.Getenv("GRAPHITE_TEMPLATES"); envGraphiteTemplates != "" {
+		config.GraphiteTemplates = splitList(envGraphiteTemplates)
+	}
+	if envGraphiteMaxConns := os.Getenv("GRAPHITE_MAX_CONNECTIONS"); envGraphiteMaxConns != "" {
+		if maxConns, err := strconv.Atoi(envGraphiteMaxConns); err == nil {
+			config.GraphiteMaxConnections = maxConns
+		}
+	}
+	if envGraphiteIdleTimeout := os.Getenv("GRAPHITE_IDLE_TIMEOUT"); envGraphiteIdleTimeout != "" {
+		if idleTimeout, err := strconv.Atoi(envGraphiteIdleTimeout); err == nil {
+			config.GraphiteIdleTimeout = time.Duration(idleTimeout) * time.Second
+		}
+	}
+	if envScrapeConfig := os.Getenv("SCRAPE_CONFIG"); envScrapeConfig != "" {
+		config.ScrapeConfig = envScrapeConfig
+	}
+	if envScrapeInterval := os.Getenv("SCRAPE_INTERVAL"); envScrapeInterval != "" {
+		if scrapeInterval, err := strconv.Atoi(envScrapeInterval); err == nil {
+			config.ScrapeInterval = time.Duration(scrapeInterval) * time.Second
+		}
+	}
 
 	return config
 }
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func parseFloats(s string) []float64 {
+	var values []float64
+	for _, item := range splitList(s) {
+		if value, err := strconv.ParseFloat(item, 64); err == nil {
+			values = append(values, value)
+		}
+	}
+	slices.Sort(values)
+	return slices.Compact(values)
+}
+
+func parseIntervals(s string) map[string]time.Duration {
+	intervals := make(map[string]time.Duration)
+	for name, value := range models.ParseLabels(s) {
+		if interval, err := time.ParseDuration(value); err == nil {
+			intervals[name] = interval
+		} else if seconds, err := strconv.Atoi(value); err == nil {
+			intervals[name] = time.Duration(seconds) * time.Second
+		}
+	}
+	return intervals
+}
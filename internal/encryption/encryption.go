@@ -0,0 +1,160 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	SchemeHeader = "X-Encryption"
+	KeyHeader    = "X-Encrypted-Key"
+
+	SchemeRSA    = "rsa-oaep"
+	SchemeHybrid = "rsa-aes-gcm"
+)
+
+var ErrUnknownScheme = errors.New("unknown encryption scheme")
+
+type Envelope struct {
+	Scheme       string
+	EncryptedKey string
+	Data         []byte
+}
+
+func LoadPublicKey(path string) (*rsa.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+		if key, ok := cert.PublicKey.(*rsa.PublicKey); ok {
+			return key, nil
+		}
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key is not RSA")
+	}
+	return key, nil
+}
+
+func LoadPrivateKey(path string) (*rsa.PrivateKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is not RSA")
+	}
+	return key, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+	return block, nil
+}
+
+func maxOAEPSize(key *rsa.PublicKey) int {
+	return key.Size() - 2*sha256.Size - 2
+}
+
+func Encrypt(key *rsa.PublicKey, data []byte) (Envelope, error) {
+	if len(data) <= maxOAEPSize(key) {
+		encrypted, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, key, data, nil)
+		if err != nil {
+			return Envelope{}, err
+		}
+		return Envelope{Scheme: SchemeRSA, Data: encrypted}, nil
+	}
+
+	sessionKey := make([]byte, 32)
+	if _, err := rand.Read(sessionKey); err != nil {
+		return Envelope{}, err
+	}
+	gcm, err := newGCM(sessionKey)
+	if err != nil {
+		return Envelope{}, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return Envelope{}, err
+	}
+
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, key, sessionKey, nil)
+	if err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{
+		Scheme:       SchemeHybrid,
+		EncryptedKey: base64.StdEncoding.EncodeToString(encryptedKey),
+		Data:         gcm.Seal(nonce, nonce, data, nil),
+	}, nil
+}
+
+func Decrypt(key *rsa.PrivateKey, envelope Envelope) ([]byte, error) {
+	switch envelope.Scheme {
+	case SchemeRSA:
+		return rsa.DecryptOAEP(sha256.New(), rand.Reader, key, envelope.Data, nil)
+	case SchemeHybrid:
+		encryptedKey, err := base64.StdEncoding.DecodeString(envelope.EncryptedKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encrypted key: %w", err)
+		}
+		sessionKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, key, encryptedKey, nil)
+		if err != nil {
+			return nil, err
+		}
+		gcm, err := newGCM(sessionKey)
+		if err != nil {
+			return nil, err
+		}
+		if len(envelope.Data) < gcm.NonceSize() {
+			return nil, fmt.Errorf("ciphertext too short")
+		}
+		nonce, ciphertext := envelope.Data[:gcm.NonceSize()], envelope.Data[gcm.NonceSize():]
+		return gcm.Open(nil, nonce, ciphertext, nil)
+	default:
+		return nil, ErrUnknownScheme
+	}
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,73 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		data   []byte
+		scheme string
+	}{
+		{"Small Payload", []byte(`[{"id":"PollCount","type":"counter","delta":1}]`), SchemeRSA},
+		{"Large Payload", bytes.Repeat([]byte("metrics"), 1000), SchemeHybrid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			envelope, err := Encrypt(&privateKey.PublicKey, tt.data)
+			require.NoError(t, err)
+			require.Equal(t, tt.scheme, envelope.Scheme)
+			require.NotEqual(t, tt.data, envelope.Data)
+
+			decrypted, err := Decrypt(privateKey, envelope)
+			require.NoError(t, err)
+			require.Equal(t, tt.data, decrypted)
+
+			envelope.Data[len(envelope.Data)-1] ^= 0xff
+			_, err = Decrypt(privateKey, envelope)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestLoadKeys(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	privatePath := filepath.Join(dir, "private.pem")
+	publicPath := filepath.Join(dir, "public.pem")
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}), 0o600))
+
+	publicDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0o644))
+
+	loadedPrivate, err := LoadPrivateKey(privatePath)
+	require.NoError(t, err)
+	require.True(t, privateKey.Equal(loadedPrivate))
+
+	loadedPublic, err := LoadPublicKey(publicPath)
+	require.NoError(t, err)
+	require.True(t, privateKey.PublicKey.Equal(loadedPublic))
+
+	_, err = LoadPublicKey(filepath.Join(dir, "missing.pem"))
+	require.Error(t, err)
+}
@@ -0,0 +1,126 @@
+package graphite
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/alisaviation/monitoring/internal/storage"
+)
+
+func TestParseLine(t *testing.T) {
+	templates, err := ParseTemplates([]string{
+		"servers.* .host.measurement*",
+		"eu.* region.host.measurement.measurement",
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		line    string
+		want    Sample
+		wantErr bool
+	}{
+		{"Plain Path", "stats.requests 12 1700000000", Sample{Name: "stats.requests", Value: 12}, false},
+		{"Without Timestamp", "stats.requests 1.5", Sample{Name: "stats.requests", Value: 1.5}, false},
+		{"Filtered Template", "servers.web01.cpu.load 0.7 1700000000", Sample{
+			Name: "cpu.load", Labels: map[string]string{"host": "web01"}, Value: 0.7,
+		}, false},
+		{"Second Template", "eu.db01.disk.used 80 1700000000", Sample{
+			Name: "disk.used", Labels: map[string]string{"region": "eu", "host": "db01"}, Value: 80,
+		}, false},
+		{"Tags", "servers.web01.cpu.load;env=prod 1 -1", Sample{
+			Name: "cpu.load", Labels: map[string]string{"host": "web01", "env": "prod"}, Value: 1,
+		}, false},
+		{"Missing Value", "stats.requests", Sample{}, true},
+		{"Invalid Value", "stats.requests abc 1700000000", Sample{}, true},
+		{"NaN Value", "stats.requests NaN 1700000000", Sample{}, true},
+		{"Invalid Timestamp", "stats.requests 1 soon", Sample{}, true},
+		{"Invalid Tag", "stats.requests;env 1 1700000000", Sample{}, true},
+		{"Invalid Tag Name", "stats.requests;a,b=c 1 1700000000", Sample{}, true},
+		{"Invalid Path", "stats{x} 1 1700000000", Sample{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLine(tt.line, templates)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want.Name, got.Name)
+			require.Equal(t, tt.want.Value, got.Value)
+			if len(tt.want.Labels) > 0 || len(got.Labels) > 0 {
+				require.Equal(t, tt.want.Labels, got.Labels)
+			}
+		})
+	}
+}
+
+func TestParseTemplate(t *testing.T) {
+	_, err := ParseTemplate("host.measurement*.field")
+	require.Error(t, err)
+	_, err = ParseTemplate("host.region")
+	require.Error(t, err)
+	_, err = ParseTemplate("a.* b.* c.measurement")
+	require.Error(t, err)
+	_, err = ParseTemplate("host-name.measurement")
+	require.Error(t, err)
+}
+
+func TestServer(t *testing.T) {
+	ctx := context.Background()
+	memStorage := storage.NewMemStorage("")
+	templates, err := ParseTemplates([]string{"servers.* .host.measurement*"})
+	require.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := NewServer(memStorage, templates)
+	server.MaxConnections = 1
+	serveCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() {
+		done <- server.Serve(serveCtx, ln)
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = fmt.Fprint(conn, "servers.web01.cpu.load 0.5 1700000000\nbogus\n")
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		value, err := memStorage.GetGauge(ctx, `cpu.load{host="web01"}`)
+		return err == nil && *value == 0.5
+	}, time.Second, 10*time.Millisecond)
+
+	// The second connection exceeds the limit and is closed by the server.
+	rejected, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer rejected.Close()
+	rejected.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = bufio.NewReader(rejected).ReadByte()
+	require.Error(t, err)
+	var netErr net.Error
+	require.False(t, errors.As(err, &netErr) && netErr.Timeout(), "connection was not closed")
+
+	// Lines sent right before shutdown are still stored.
+	_, err = fmt.Fprint(conn, "stats.requests 3\n")
+	require.NoError(t, err)
+	cancel()
+	require.NoError(t, <-done)
+	value, err := memStorage.GetGauge(ctx, "stats.requests")
+	require.NoError(t, err)
+	require.Equal(t, 3.0, *value)
+	_, err = net.Dial("tcp", ln.Addr().String())
+	require.Error(t, err)
+}
@@ -0,0 +1,167 @@
+package graphite
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/alisaviation/monitoring/internal/models"
+)
+
+type Sample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+}
+
+// ParseLine parses "path value [timestamp]". Tags in the Graphite 1.1 form
+// "path;tag=value" become labels. The timestamp is validated but not used,
+// samples are stored at the time they are received.
+func ParseLine(line string, templates []Template) (Sample, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return Sample{}, errors.New("expected \"path value [timestamp]\"")
+	}
+
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return Sample{}, fmt.Errorf("invalid value %q", fields[1])
+	}
+	if len(fields) == 3 {
+		if _, err := strconv.ParseFloat(fields[2], 64); err != nil {
+			return Sample{}, fmt.Errorf("invalid timestamp %q", fields[2])
+		}
+	}
+
+	path, tags, _ := strings.Cut(fields[0], ";")
+	if path == "" || strings.ContainsAny(path, "{}") {
+		return Sample{}, fmt.Errorf("invalid path %q", path)
+	}
+
+	sample := Sample{Name: path, Value: value}
+	for _, template := range templates {
+		if template.Match(path) {
+			sample.Name, sample.Labels = template.Apply(path)
+			break
+		}
+	}
+	if tags != "" {
+		if sample.Labels == nil {
+			sample.Labels = make(map[string]string)
+		}
+		for _, tag := range strings.Split(tags, ";") {
+			key, tagValue, found := strings.Cut(tag, "=")
+			if !found || !models.ValidLabelName(key) {
+				return Sample{}, fmt.Errorf("invalid tag %q", tag)
+			}
+			sample.Labels[key] = tagValue
+		}
+	}
+	return sample, nil
+}
+
+func (s Sample) Key() string {
+	return models.SeriesKey(s.Name, s.Labels)
+}
+
+// Template maps path segments to a metric ID and labels, e.g. the template
+// "servers.* .host.measurement*" turns "servers.web01.cpu.load" into
+// cpu.load{host="web01"}. Pattern segments are:
+//
+//	measurement   the segment is part of the metric ID
+//	measurement*  this and all remaining segments are part of the metric ID
+//	(empty)       the segment is dropped
+//	anything else the segment becomes the value of a label with that name
+//
+// The optional filter matches the leading path segments, "*" matches any segment.
+type Template struct {
+	filter  []string
+	pattern []string
+}
+
+func ParseTemplate(s string) (Template, error) {
+	fields := strings.Fields(s)
+	var template Template
+	switch len(fields) {
+	case 1:
+		template.pattern = strings.Split(fields[0], ".")
+	case 2:
+		template.filter = strings.Split(fields[0], ".")
+		template.pattern = strings.Split(fields[1], ".")
+	default:
+		return Template{}, fmt.Errorf("invalid template %q", s)
+	}
+
+	hasMeasurement := false
+	for i, segment := range template.pattern {
+		switch segment {
+		case "measurement":
+			hasMeasurement = true
+		case "measurement*":
+			if i != len(template.pattern)-1 {
+				return Template{}, fmt.Errorf("template %q: measurement* must be the last segment", s)
+			}
+			hasMeasurement = true
+		case "":
+		default:
+			if !models.ValidLabelName(segment) {
+				return Template{}, fmt.Errorf("template %q: invalid tag name %q", s, segment)
+			}
+		}
+	}
+	if !hasMeasurement {
+		return Template{}, fmt.Errorf("template %q has no measurement segment", s)
+	}
+	return template, nil
+}
+
+func ParseTemplates(specs []string) ([]Template, error) {
+	templates := make([]Template, 0, len(specs))
+	for _, spec := range specs {
+		template, err := ParseTemplate(spec)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, template)
+	}
+	return templates, nil
+}
+
+func (t Template) Match(path string) bool {
+	segments := strings.Split(path, ".")
+	if len(segments) < len(t.filter) {
+		return false
+	}
+	for i, filter := range t.filter {
+		if filter != "*" && filter != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (t Template) Apply(path string) (string, map[string]string) {
+	segments := strings.Split(path, ".")
+	var name []string
+	labels := make(map[string]string)
+	for i, segment := range segments {
+		if i >= len(t.pattern) {
+			break
+		}
+		switch t.pattern[i] {
+		case "":
+		case "measurement":
+			name = append(name, segment)
+		case "measurement*":
+			name = append(name, segments[i:]...)
+		default:
+			labels[t.pattern[i]] = segment
+		}
+	}
+	if len(name) == 0 {
+		return path, labels
+	}
+	return strings.Join(name, "."), labels
+}
@@ -0,0 +1,154 @@
+package graphite
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/alisaviation/monitoring/internal/logger"
+	"github.com/alisaviation/monitoring/internal/storage"
+)
+
+const (
+	maxLineSize = 64 * 1024
+	// drainTimeout bounds how long open connections may keep sending after shutdown starts.
+	drainTimeout = time.Second
+)
+
+type Server struct {
+	TrustedSubnet *net.IPNet
+	// MaxConnections limits concurrent connections, further ones are closed right away. Unlimited when 0.
+	MaxConnections int
+	// IdleTimeout closes connections that send nothing for this long. Disabled when 0.
+	IdleTimeout time.Duration
+
+	storage   storage.Storage
+	templates []Template
+	conns     map[net.Conn]struct{}
+	drainAt   time.Time
+	mu        sync.Mutex
+	wg        sync.WaitGroup
+}
+
+func NewServer(storage storage.Storage, templates []Template) *Server {
+	return &Server{
+		storage:   storage,
+		templates: templates,
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// Serve accepts connections until ctx is cancelled. On shutdown it stops
+// accepting, gives open connections drainTimeout to deliver lines in flight
+// and waits for them to finish.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+		s.mu.Lock()
+		s.drainAt = time.Now().Add(drainTimeout)
+		for conn := range s.conns {
+			conn.SetReadDeadline(s.drainAt)
+		}
+		s.mu.Unlock()
+	}()
+	defer s.wg.Wait()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		if !s.allowed(conn.RemoteAddr()) {
+			logger.Log.Debug("Rejecting Graphite connection from untrusted address", zap.String("addr", conn.RemoteAddr().String()))
+			conn.Close()
+			continue
+		}
+		if !s.track(ctx, conn) {
+			logger.Log.Warn("Rejecting Graphite connection, limit reached", zap.Int("max_connections", s.MaxConnections))
+			conn.Close()
+			continue
+		}
+		go func() {
+			defer s.wg.Done()
+			defer s.untrack(conn)
+			s.handleConn(ctx, conn)
+		}()
+	}
+}
+
+func (s *Server) allowed(addr net.Addr) bool {
+	if s.TrustedSubnet == nil {
+		return true
+	}
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	return ok && s.TrustedSubnet.Contains(tcpAddr.IP)
+}
+
+func (s *Server) track(ctx context.Context, conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ctx.Err() != nil || (s.MaxConnections > 0 && len(s.conns) >= s.MaxConnections) {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+	return true
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+	conn.Close()
+}
+
+func (s *Server) handleConn(ctx context.Context, conn net.Conn) {
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), maxLineSize)
+	for {
+		if s.IdleTimeout > 0 {
+			s.extendDeadline(conn)
+		}
+		if !scanner.Scan() {
+			break
+		}
+		s.HandleLine(context.WithoutCancel(ctx), scanner.Text())
+	}
+	var netErr net.Error
+	if err := scanner.Err(); err != nil && !(errors.As(err, &netErr) && netErr.Timeout()) {
+		logger.Log.Debug("Graphite connection closed", zap.String("addr", conn.RemoteAddr().String()), zap.Error(err))
+	}
+}
+
+func (s *Server) extendDeadline(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deadline := time.Now().Add(s.IdleTimeout)
+	if !s.drainAt.IsZero() && s.drainAt.Before(deadline) {
+		deadline = s.drainAt
+	}
+	conn.SetReadDeadline(deadline)
+}
+
+func (s *Server) HandleLine(ctx context.Context, line string) {
+	if line == "" {
+		return
+	}
+	sample, err := ParseLine(line, s.templates)
+	if err != nil {
+		logger.Log.Debug("Invalid Graphite line", zap.String("line", line), zap.Error(err))
+		return
+	}
+	if err := s.storage.SetGauge(ctx, sample.Key(), sample.Value); err != nil {
+		logger.Log.Error("Failed to store Graphite sample", zap.String("name", sample.Name), zap.Error(err))
+	}
+}
@@ -1,7 +1,9 @@
 package helpers
 
 import (
-	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/http"
@@ -10,10 +12,13 @@ import (
 
 	"github.com/jackc/pgerrcode"
 	"github.com/lib/pq"
-	"go.uber.org/zap"
+)
+
+const (
+	HashHeader   = "HashSHA256"
+	RealIPHeader = "X-Real-IP"
 
-	"github.com/alisaviation/monitoring/internal/logger"
-	"github.com/alisaviation/monitoring/internal/storage"
+	RealIPMetadataKey = "x-real-ip"
 )
 
 const (
@@ -37,42 +42,17 @@ func MethodCheck(methods []string) func(next http.HandlerFunc) http.HandlerFunc
 	}
 }
 
+func ComputeHash(data []byte, key string) string {
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
 func FormatFloat(value float64) string {
 	formatted := fmt.Sprintf("%.3f", value)
 	return strings.TrimRight(strings.TrimRight(formatted, "0"), ".")
 }
 
-func CheckAndSaveMetrics(ctx context.Context, storage storage.Storage, prevGauges map[string]float64, prevCounters map[string]int64) {
-	currentGauges, _ := storage.Gauges(ctx)
-	currentCounters, _ := storage.Counters(ctx)
-
-	gaugeChanged := len(prevGauges) != len(currentGauges)
-	if !gaugeChanged {
-		for k, v := range currentGauges {
-			if prevGauges[k] != v {
-				gaugeChanged = true
-				break
-			}
-		}
-	}
-
-	counterChanged := len(prevCounters) != len(currentCounters)
-	if !counterChanged {
-		for k, v := range currentCounters {
-			if prevCounters[k] != v {
-				counterChanged = true
-				break
-			}
-		}
-	}
-
-	if gaugeChanged || counterChanged {
-		if err := storage.Save(); err != nil {
-			logger.Log.Error("Error saving metrics", zap.Error(err))
-		}
-	}
-}
-
 func IsRetriablePostgresError(err error) bool {
 	var pqErr *pq.Error
 	if !errors.As(err, &pqErr) {
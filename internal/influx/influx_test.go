@@ -0,0 +1,72 @@
+package influx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    Point
+		wantErr bool
+	}{
+		{
+			name: "Tags And Fields",
+			line: "cpu,host=web01,region=eu usage_idle=92.5,usage_user=3i 1700000000000000000",
+			want: Point{
+				Measurement: "cpu",
+				Tags:        map[string]string{"host": "web01", "region": "eu"},
+				Fields:      []Field{{Key: "usage_idle", Float: 92.5}, {Key: "usage_user", Integer: true, Int: 3}},
+				Time:        time.Unix(1700000000, 0),
+			},
+		},
+		{
+			name: "Escapes And Strings",
+			line: `disk\ io,path=C:\\data,label=a\,b\=c read=1u,status="up, ok",healthy=t`,
+			want: Point{
+				Measurement: "disk io",
+				Tags:        map[string]string{"path": `C:\data`, "label": "a,b=c"},
+				Fields:      []Field{{Key: "read", Integer: true, Int: 1}, {Key: "healthy", Float: 1}},
+			},
+		},
+		{name: "Missing Fields", line: "cpu,host=web01", wantErr: true},
+		{name: "Invalid Tag", line: "cpu,host usage=1", wantErr: true},
+		{name: "Invalid Tag Name", line: `cpu,host\=a=web01 usage=1`, wantErr: true},
+		{name: "Invalid Field", line: "cpu usage", wantErr: true},
+		{name: "Invalid Integer", line: "cpu usage=1.5i", wantErr: true},
+		{name: "Negative Unsigned", line: "cpu usage=-1u", wantErr: true},
+		{name: "NaN Field", line: "cpu usage=NaN", wantErr: true},
+		{name: "Inf Field", line: "cpu usage=-Inf", wantErr: true},
+		{name: "Invalid Timestamp", line: "cpu usage=1 yesterday", wantErr: true},
+		{name: "Unterminated String", line: `cpu status="up`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLine(tt.line, time.Nanosecond)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	points, err := Parse([]byte("# comment\ncpu usage=1 1700000000\n\nmem used=2i\n"), "s")
+	require.NoError(t, err)
+	require.Len(t, points, 2)
+	require.Equal(t, time.Unix(1700000000, 0), points[0].Time)
+
+	_, err = Parse([]byte("cpu usage=1\ncpu usage\n"), "")
+	require.ErrorContains(t, err, "line 2")
+
+	_, err = Parse([]byte("cpu usage=1"), "h")
+	require.Error(t, err)
+}
@@ -0,0 +1,194 @@
+package influx
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alisaviation/monitoring/internal/models"
+)
+
+type Field struct {
+	Key string
+	// Integer is set for "i" and "u" suffixed values, which are kept in Int.
+	Integer bool
+	Int     int64
+	Float   float64
+}
+
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      []Field
+	Time        time.Time
+}
+
+var precisions = map[string]time.Duration{
+	"":   time.Nanosecond,
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+}
+
+// Parse parses a line protocol batch. The batch is rejected as a whole if any line is invalid.
+func Parse(data []byte, precision string) ([]Point, error) {
+	unit, ok := precisions[precision]
+	if !ok {
+		return nil, fmt.Errorf("invalid precision %q", precision)
+	}
+
+	var points []Point
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		point, err := ParseLine(line, unit)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		points = append(points, point)
+	}
+	return points, nil
+}
+
+// ParseLine parses "measurement[,tag=value...] field=value[,field=value...] [timestamp]".
+// String fields are accepted but dropped, booleans become 1 and 0.
+func ParseLine(line string, unit time.Duration) (Point, error) {
+	sections := split(line, ' ', true)
+	if len(sections) < 2 || len(sections) > 3 {
+		return Point{}, errors.New("expected measurement, fields and optional timestamp")
+	}
+
+	series := split(sections[0], ',', false)
+	point := Point{Measurement: unescape(series[0])}
+	if point.Measurement == "" {
+		return Point{}, errors.New("missing measurement")
+	}
+	for _, tag := range series[1:] {
+		key, value, err := cutPair(tag)
+		if err != nil {
+			return Point{}, fmt.Errorf("invalid tag %q: %w", tag, err)
+		}
+		if !models.ValidLabelName(key) {
+			return Point{}, fmt.Errorf("invalid tag name %q", key)
+		}
+		if point.Tags == nil {
+			point.Tags = make(map[string]string)
+		}
+		point.Tags[key] = value
+	}
+
+	for _, rawField := range split(sections[1], ',', true) {
+		key, rawValue, found := cutUnescaped(rawField, '=')
+		if !found || key == "" || rawValue == "" {
+			return Point{}, fmt.Errorf("invalid field %q", rawField)
+		}
+		if strings.HasPrefix(rawValue, `"`) {
+			if len(rawValue) < 2 || !strings.HasSuffix(rawValue, `"`) {
+				return Point{}, fmt.Errorf("unterminated string field %q", rawField)
+			}
+			continue
+		}
+		field, err := parseField(unescape(key), rawValue)
+		if err != nil {
+			return Point{}, err
+		}
+		point.Fields = append(point.Fields, field)
+	}
+
+	if len(sections) == 3 {
+		ts, err := strconv.ParseInt(sections[2], 10, 64)
+		if err != nil {
+			return Point{}, fmt.Errorf("invalid timestamp %q", sections[2])
+		}
+		point.Time = time.Unix(0, ts*int64(unit))
+	}
+	return point, nil
+}
+
+func parseField(key, value string) (Field, error) {
+	field := Field{Key: key}
+	var err error
+	switch {
+	case strings.HasSuffix(value, "i"):
+		field.Integer = true
+		field.Int, err = strconv.ParseInt(strings.TrimSuffix(value, "i"), 10, 64)
+	case strings.HasSuffix(value, "u"):
+		var u uint64
+		u, err = strconv.ParseUint(strings.TrimSuffix(value, "u"), 10, 63)
+		field.Integer = true
+		field.Int = int64(u)
+	default:
+		switch value {
+		case "t", "T", "true", "True", "TRUE":
+			field.Float = 1
+		case "f", "F", "false", "False", "FALSE":
+			field.Float = 0
+		default:
+			field.Float, err = strconv.ParseFloat(value, 64)
+		}
+	}
+	if err != nil || math.IsNaN(field.Float) || math.IsInf(field.Float, 0) {
+		return Field{}, fmt.Errorf("invalid value %q for field %q", value, key)
+	}
+	return field, nil
+}
+
+func cutPair(s string) (string, string, error) {
+	key, value, found := cutUnescaped(s, '=')
+	if !found || key == "" || value == "" {
+		return "", "", errors.New("expected key=value")
+	}
+	return unescape(key), unescape(value), nil
+}
+
+// split splits s on sep, skipping backslash-escaped separators and, when quoted is set,
+// separators inside double-quoted string values.
+func split(s string, sep byte, quoted bool) []string {
+	var parts []string
+	start := 0
+	inQuote := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case s[i] == '"' && quoted:
+			inQuote = !inQuote
+		case s[i] == sep && !inQuote:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func cutUnescaped(s string, sep byte) (string, string, bool) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			return s[:i], s[i+1:], true
+		}
+	}
+	return s, "", false
+}
+
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(`, ="\`, s[i+1]) >= 0 {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
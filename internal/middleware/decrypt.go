@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"io"
+	"net/http"
+
+	"github.com/alisaviation/monitoring/internal/encryption"
+)
+
+func DecryptMiddleware(key *rsa.PrivateKey) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if key == nil || r.Method != http.MethodPost {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			scheme := r.Header.Get(encryption.SchemeHeader)
+			if scheme == "" {
+				http.Error(w, "Bad Request: encrypted body required", http.StatusBadRequest)
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, "Bad Request: failed to read body", http.StatusBadRequest)
+				return
+			}
+			r.Body.Close()
+
+			decrypted, err := encryption.Decrypt(key, encryption.Envelope{
+				Scheme:       scheme,
+				EncryptedKey: r.Header.Get(encryption.KeyHeader),
+				Data:         body,
+			})
+			if err != nil {
+				http.Error(w, "Bad Request: failed to decrypt body", http.StatusBadRequest)
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(decrypted))
+			r.ContentLength = int64(len(decrypted))
+			r.Header.Del(encryption.SchemeHeader)
+			r.Header.Del(encryption.KeyHeader)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/hex"
+	"io"
+	"net/http"
+
+	"github.com/alisaviation/monitoring/internal/helpers"
+)
+
+func HashMiddleware(key string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.Method == http.MethodPost {
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					http.Error(w, "Bad Request: failed to read body", http.StatusBadRequest)
+					return
+				}
+				r.Body.Close()
+
+				received, err := hex.DecodeString(r.Header.Get(helpers.HashHeader))
+				if err != nil || len(received) == 0 {
+					http.Error(w, "Bad Request: missing or malformed hash", http.StatusBadRequest)
+					return
+				}
+				expected, _ := hex.DecodeString(helpers.ComputeHash(body, key))
+				if !hmac.Equal(received, expected) {
+					http.Error(w, "Bad Request: hash mismatch", http.StatusBadRequest)
+					return
+				}
+				r.Body = io.NopCloser(bytes.NewReader(body))
+			}
+
+			hw := &hashWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			next.ServeHTTP(hw, r)
+
+			body := hw.body.Bytes()
+			w.Header().Set(helpers.HashHeader, helpers.ComputeHash(body, key))
+			w.WriteHeader(hw.statusCode)
+			w.Write(body)
+		})
+	}
+}
+
+type hashWriter struct {
+	http.ResponseWriter
+	body       bytes.Buffer
+	statusCode int
+}
+
+func (h *hashWriter) WriteHeader(code int) {
+	h.statusCode = code
+}
+
+func (h *hashWriter) Write(b []byte) (int, error) {
+	return h.body.Write(b)
+}
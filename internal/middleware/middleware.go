@@ -3,13 +3,14 @@ package middleware
 import (
 	"compress/gzip"
 	"io"
-	"log"
 	"net/http"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/alisaviation/monitoring/internal/helpers"
+	"go.uber.org/zap"
+
+	"github.com/alisaviation/monitoring/internal/logger"
 	"github.com/alisaviation/monitoring/internal/storage"
 )
 
@@ -45,55 +46,34 @@ func (g gzipWriter) Write(b []byte) (int, error) {
 	return g.Writer.Write(b)
 }
 
+// SyncSaveMiddleware saves after every successful write when storeInterval is zero,
+// so histograms and summaries are persisted as well as gauges and counters.
 func SyncSaveMiddleware(storeInterval time.Duration, storage storage.Storage) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if r.Method == http.MethodPost {
-				var prevGauges map[string]float64
-				var prevCounters map[string]int64
-
-				if storeInterval == 0 {
-					prevGauges = make(map[string]float64)
-					prevCounters = make(map[string]int64)
-
-					gauges, err := storage.Gauges(r.Context())
-					if err != nil {
-						log.Println("Error getting gauges:", err)
-					} else {
-						for k, v := range gauges {
-							prevGauges[k] = v
-						}
+			if storeInterval != 0 || (r.Method != http.MethodPost && r.Method != http.MethodDelete) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ww := &responseWriterWrapper{
+				ResponseWriter: w,
+				onWriteHeader: func(code int) {
+					if code < 200 || code >= 300 {
+						return
 					}
-
-					counters, err := storage.Counters(r.Context())
-					if err != nil {
-						log.Println("Error getting counters:", err)
-					} else {
-						for k, v := range counters {
-							prevCounters[k] = v
-						}
+					if err := storage.Save(); err != nil {
+						logger.Log.Error("Error saving metrics", zap.Error(err))
 					}
-
-				}
-				ww := &responseWriterWrapper{
-					ResponseWriter: w,
-					onWriteHeader: func() {
-						if storeInterval == 0 {
-							helpers.CheckAndSaveMetrics(r.Context(), storage, prevGauges, prevCounters)
-						}
-					},
-				}
-				next.ServeHTTP(ww, r)
-				return
+				},
 			}
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(ww, r)
 		})
 	}
 }
 
 type responseWriterWrapper struct {
 	http.ResponseWriter
-	onWriteHeader func()
+	onWriteHeader func(code int)
 	headerWritten bool
 	mu            sync.Mutex
 }
@@ -104,7 +84,7 @@ func (w *responseWriterWrapper) WriteHeader(code int) {
 	if !w.headerWritten {
 		w.headerWritten = true
 		if w.onWriteHeader != nil {
-			w.onWriteHeader()
+			w.onWriteHeader(code)
 		}
 	}
 	w.ResponseWriter.WriteHeader(code)
@@ -115,7 +95,7 @@ func (w *responseWriterWrapper) Write(b []byte) (int, error) {
 	if !w.headerWritten {
 		w.headerWritten = true
 		if w.onWriteHeader != nil {
-			w.onWriteHeader()
+			w.onWriteHeader(http.StatusOK)
 		}
 	}
 	w.mu.Unlock()
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type Bucket struct {
+	UpperBound float64 `json:"le"`
+	Count      uint64  `json:"count"`
+}
+
+// HistogramValue holds cumulative bucket counts; observations above the last bound are only reflected in Count.
+type HistogramValue struct {
+	Buckets []Bucket `json:"buckets"`
+	Sum     float64  `json:"sum"`
+	Count   uint64   `json:"count"`
+}
+
+type Quantile struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
+type SummaryValue struct {
+	Quantiles []Quantile `json:"quantiles"`
+	Sum       float64    `json:"sum"`
+	Count     uint64     `json:"count"`
+}
+
+func NewHistogram(bounds []float64) *HistogramValue {
+	h := &HistogramValue{Buckets: make([]Bucket, len(bounds))}
+	for i, bound := range bounds {
+		h.Buckets[i].UpperBound = bound
+	}
+	return h
+}
+
+func (h *HistogramValue) Observe(value float64) {
+	h.ObserveN(value, 1)
+}
+
+// ObserveN records value n times, e.g. to scale up sampled observations.
+func (h *HistogramValue) ObserveN(value float64, n uint64) {
+	for i := range h.Buckets {
+		if value <= h.Buckets[i].UpperBound {
+			h.Buckets[i].Count += n
+		}
+	}
+	h.Sum += value * float64(n)
+	h.Count += n
+}
+
+func (h *HistogramValue) Validate() error {
+	if !finite(h.Sum) {
+		return errors.New("sum must be finite")
+	}
+	var prev *Bucket
+	for i := range h.Buckets {
+		bucket := &h.Buckets[i]
+		if !finite(bucket.UpperBound) {
+			return errors.New("bucket bound must be finite")
+		}
+		if prev != nil && bucket.UpperBound <= prev.UpperBound {
+			return errors.New("bucket bounds must be strictly increasing")
+		}
+		if prev != nil && bucket.Count < prev.Count {
+			return errors.New("bucket counts must be cumulative")
+		}
+		prev = bucket
+	}
+	if prev != nil && h.Count < prev.Count {
+		return errors.New("count is less than the last bucket")
+	}
+	return nil
+}
+
+func (h *HistogramValue) sameLayout(other HistogramValue) bool {
+	if len(h.Buckets) != len(other.Buckets) {
+		return false
+	}
+	for i := range h.Buckets {
+		if h.Buckets[i].UpperBound != other.Buckets[i].UpperBound {
+			return false
+		}
+	}
+	return true
+}
+
+// Merge adds delta to h. A delta with a different bucket layout replaces h entirely,
+// since counts from incompatible buckets cannot be combined.
+func (h *HistogramValue) Merge(delta HistogramValue) {
+	if !h.sameLayout(delta) {
+		*h = delta.Clone()
+		return
+	}
+	for i := range h.Buckets {
+		h.Buckets[i].Count += delta.Buckets[i].Count
+	}
+	h.Sum += delta.Sum
+	h.Count += delta.Count
+}
+
+func (h HistogramValue) Clone() HistogramValue {
+	h.Buckets = append([]Bucket(nil), h.Buckets...)
+	return h
+}
+
+func (h HistogramValue) String() string {
+	parts := make([]string, 0, len(h.Buckets)+1)
+	for _, bucket := range h.Buckets {
+		parts = append(parts, fmt.Sprintf("%s:%d", formatBound(bucket.UpperBound), bucket.Count))
+	}
+	parts = append(parts, fmt.Sprintf("+Inf:%d", h.Count))
+	return fmt.Sprintf("count=%d sum=%s buckets={%s}", h.Count, formatBound(h.Sum), strings.Join(parts, ","))
+}
+
+func (s *SummaryValue) Validate() error {
+	if !finite(s.Sum) {
+		return errors.New("sum must be finite")
+	}
+	for _, q := range s.Quantiles {
+		if math.IsNaN(q.Quantile) || q.Quantile < 0 || q.Quantile > 1 {
+			return errors.New("quantile must be between 0 and 1")
+		}
+		if !finite(q.Value) {
+			return errors.New("quantile value must be finite")
+		}
+	}
+	return nil
+}
+
+// finite reports whether v can be encoded as JSON in the WAL and snapshots.
+func finite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+func (s SummaryValue) Clone() SummaryValue {
+	s.Quantiles = append([]Quantile(nil), s.Quantiles...)
+	return s
+}
+
+func (s SummaryValue) String() string {
+	parts := make([]string, 0, len(s.Quantiles))
+	for _, q := range s.Quantiles {
+		parts = append(parts, fmt.Sprintf("%s:%s", formatBound(q.Quantile), formatBound(q.Value)))
+	}
+	return fmt.Sprintf("count=%d sum=%s quantiles={%s}", s.Count, formatBound(s.Sum), strings.Join(parts, ","))
+}
+
+func formatBound(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
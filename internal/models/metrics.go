@@ -1,15 +1,35 @@
 package models
 
+import "time"
+
 const (
-	Gauge   string = "gauge"
-	Counter string = "counter"
+	Gauge     string = "gauge"
+	Counter   string = "counter"
+	Histogram string = "histogram"
+	Summary   string = "summary"
 )
 
+func ValidType(mType string) bool {
+	switch mType {
+	case Gauge, Counter, Histogram, Summary:
+		return true
+	}
+	return false
+}
+
 type Metric struct {
 	ID    string   `json:"id"`
 	MType string   `json:"type"`
 	Delta *int64   `json:"delta,omitempty"`
 	Value *float64 `json:"value,omitempty"`
+
+	Histogram *HistogramValue `json:"histogram,omitempty"`
+	Summary   *SummaryValue   `json:"summary,omitempty"`
+
+	Labels map[string]string `json:"labels,omitempty"`
+
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	Stale     bool       `json:"stale,omitempty"`
 }
 
 const (
@@ -43,3 +63,28 @@ const (
 	RandomValue   = "RandomValue"
 	PollCount     = "PollCount"
 )
+
+const (
+	TotalMemory    = "TotalMemory"
+	FreeMemory     = "FreeMemory"
+	CPUutilization = "CPUutilization"
+	LoadAverage1   = "LoadAverage1"
+	LoadAverage5   = "LoadAverage5"
+	LoadAverage15  = "LoadAverage15"
+
+	DiskTotal = "DiskTotal"
+	DiskFree  = "DiskFree"
+	DiskUsed  = "DiskUsed"
+
+	NetworkBytesReceived = "NetworkBytesReceived"
+	NetworkBytesSent     = "NetworkBytesSent"
+)
+
+type Sample struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+func (m Metric) Key() string {
+	return SeriesKey(m.ID, m.Labels)
+}
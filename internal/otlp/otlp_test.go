@@ -0,0 +1,149 @@
+package otlp
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/alisaviation/monitoring/internal/models"
+)
+
+func request(t *testing.T, body string) ExportRequest {
+	var req ExportRequest
+	require.NoError(t, json.Unmarshal([]byte(body), &req))
+	return req
+}
+
+// translate commits the baselines the way a successful export does.
+func translate(t *testing.T, translator *Translator, req ExportRequest) []models.Metric {
+	batch, err := translator.Translate(req)
+	require.NoError(t, err)
+	defer batch.Release()
+	batch.Commit()
+	return batch.Metrics
+}
+
+func sumRequest(t *testing.T, start int64, value string) ExportRequest {
+	return request(t, fmt.Sprintf(`{"resourceMetrics":[{
+		"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"api"}}]},
+		"scopeMetrics":[{"metrics":[{"name":"requests","sum":{
+			"aggregationTemporality":2,"isMonotonic":true,
+			"dataPoints":[{"startTimeUnixNano":"%d","asInt":"%s","attributes":[{"key":"code","value":{"intValue":"200"}}]}]
+		}}]}]
+	}]}`, start, value))
+}
+
+func TestTranslateCumulativeSum(t *testing.T) {
+	translator := NewTranslator()
+	start := time.Now().Add(time.Minute).UnixNano()
+
+	var deltas []int64
+	for _, value := range []string{"10", "15", "15", "4"} {
+		metrics := translate(t, translator, sumRequest(t, start, value))
+		require.Len(t, metrics, 1)
+		require.Equal(t, models.Counter, metrics[0].MType)
+		require.Equal(t, map[string]string{"service_name": "api", "code": "200"}, metrics[0].Labels)
+		deltas = append(deltas, *metrics[0].Delta)
+	}
+	// The drop from 15 to 4 is a reset, so the whole value counts.
+	require.Equal(t, []int64{10, 5, 0, 4}, deltas)
+
+	// A series that started before the translator only sets the baseline.
+	before := time.Now().Add(-time.Hour).UnixNano()
+	translator = NewTranslator()
+	metrics := translate(t, translator, sumRequest(t, before, "100"))
+	require.Empty(t, metrics)
+	metrics = translate(t, translator, sumRequest(t, before, "103"))
+	require.Equal(t, int64(3), *metrics[0].Delta)
+}
+
+func TestTranslateRetryAndReorder(t *testing.T) {
+	translator := NewTranslator()
+	start := time.Now().Add(time.Minute).UnixNano()
+	point := func(at int64, value string) ExportRequest {
+		return request(t, fmt.Sprintf(`{"resourceMetrics":[{"scopeMetrics":[{"metrics":[{"name":"jobs","sum":{
+			"aggregationTemporality":2,"isMonotonic":true,
+			"dataPoints":[{"startTimeUnixNano":"%d","timeUnixNano":"%d","asInt":"%s"}]
+		}}]}]}]}`, start, start+at, value))
+	}
+
+	translate(t, translator, point(1, "10"))
+
+	// A failed store leaves the baseline untouched, so the retry yields the same delta.
+	batch, err := translator.Translate(point(2, "15"))
+	require.NoError(t, err)
+	require.Equal(t, int64(5), *batch.Metrics[0].Delta)
+	batch.Release()
+	metrics := translate(t, translator, point(2, "15"))
+	require.Equal(t, int64(5), *metrics[0].Delta)
+
+	// A late point older than the baseline is dropped instead of treated as a reset.
+	require.Empty(t, translate(t, translator, point(1, "10")))
+	metrics = translate(t, translator, point(3, "16"))
+	require.Equal(t, int64(1), *metrics[0].Delta)
+
+	translator.Forget(func(mType, key string) bool { return key == "jobs" })
+	require.Empty(t, translator.last)
+}
+
+func TestTranslateGaugeAndHistogram(t *testing.T) {
+	translator := NewTranslator()
+	body := `{"resourceMetrics":[{"scopeMetrics":[{"metrics":[
+		{"name":"temperature","gauge":{"dataPoints":[{"asDouble":21.5},{"asDouble":"NaN"},{"asDouble":"Infinity"},{"asDouble":1,"flags":1}]}},
+		{"name":"queue","sum":{"aggregationTemporality":2,"isMonotonic":false,"dataPoints":[{"asInt":"-3"},{"asDouble":"-Infinity"}]}},
+		{"name":"latency","histogram":{"aggregationTemporality":1,"dataPoints":[
+			{"count":"4","sum":2.5,"bucketCounts":["1","2","1"],"explicitBounds":[0.1,1]}
+		]}},
+		{"name":"ignored","exponentialHistogram":{"dataPoints":[{"count":"1"}]}}
+	]}]}]}`
+
+	metrics := translate(t, translator, request(t, body))
+	require.Len(t, metrics, 3)
+
+	require.Equal(t, "temperature", metrics[0].ID)
+	require.Equal(t, 21.5, *metrics[0].Value)
+	require.Equal(t, models.Gauge, metrics[1].MType)
+	require.Equal(t, -3.0, *metrics[1].Value)
+	require.Equal(t, models.HistogramValue{
+		Buckets: []models.Bucket{{UpperBound: 0.1, Count: 1}, {UpperBound: 1, Count: 3}},
+		Sum:     2.5,
+		Count:   4,
+	}, *metrics[2].Histogram)
+
+	_, err := translator.Translate(request(t, `{"resourceMetrics":[{"scopeMetrics":[{"metrics":[
+		{"name":"latency","histogram":{"aggregationTemporality":1,"dataPoints":[{"count":"1","bucketCounts":["1"],"explicitBounds":[1]}]}}
+	]}]}]}`))
+	require.Error(t, err)
+
+	for _, dp := range []string{
+		`{"count":"1","sum":"NaN"}`,
+		`{"count":"1","sum":"Infinity","bucketCounts":["1","0"],"explicitBounds":[1]}`,
+		`{"count":"1","sum":1,"bucketCounts":["0","1","0"],"explicitBounds":[1,"Infinity"]}`,
+	} {
+		_, err = translator.Translate(request(t, `{"resourceMetrics":[{"scopeMetrics":[{"metrics":[
+			{"name":"latency","histogram":{"aggregationTemporality":1,"dataPoints":[`+dp+`]}}
+		]}]}]}`))
+		require.Error(t, err, dp)
+	}
+}
+
+func TestTranslateCumulativeHistogram(t *testing.T) {
+	translator := NewTranslator()
+	start := time.Now().Add(time.Minute).UnixNano()
+	body := `{"resourceMetrics":[{"scopeMetrics":[{"metrics":[
+		{"name":"latency","histogram":{"aggregationTemporality":2,"dataPoints":[
+			{"startTimeUnixNano":"%d","count":"%d","sum":%d,"bucketCounts":["%d","0"],"explicitBounds":[1]}
+		]}}
+	]}]}]}`
+
+	translate(t, translator, request(t, fmt.Sprintf(body, start, 2, 1, 2)))
+	metrics := translate(t, translator, request(t, fmt.Sprintf(body, start, 5, 3, 5)))
+	require.Equal(t, models.HistogramValue{
+		Buckets: []models.Bucket{{UpperBound: 1, Count: 3}},
+		Sum:     2,
+		Count:   3,
+	}, *metrics[0].Histogram)
+}
@@ -0,0 +1,340 @@
+package otlp
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alisaviation/monitoring/internal/models"
+)
+
+const lockStripes = 64
+
+// Translator converts OTLP metrics into metric updates. Counters and
+// histograms are stored as deltas, so it remembers the last cumulative
+// point of every series to turn cumulative points into deltas.
+type Translator struct {
+	started time.Time
+	last    map[seriesID]cumulative
+	mu      sync.Mutex
+	// stripes serialize translate-and-store cycles per series.
+	stripes [lockStripes]sync.Mutex
+}
+
+type seriesID struct {
+	mType string
+	key   string
+}
+
+type cumulative struct {
+	start     uint64
+	time      uint64
+	total     int64
+	histogram models.HistogramValue
+	seen      time.Time
+}
+
+// Batch holds translated metrics and the cumulative baselines they were
+// computed from. The baselines only take effect on Commit, which must be
+// called once the metrics are stored. Release must always be called.
+type Batch struct {
+	Metrics []models.Metric
+
+	t       *Translator
+	stripes []int
+	pending map[seriesID]cumulative
+}
+
+func NewTranslator() *Translator {
+	return &Translator{
+		started: time.Now(),
+		last:    make(map[seriesID]cumulative),
+	}
+}
+
+// Translate maps monotonic sums to counters, gauges and non-monotonic sums
+// to gauges and histograms to histograms. Resource attributes become labels,
+// data point attributes override them.
+func (t *Translator) Translate(req ExportRequest) (*Batch, error) {
+	batch := &Batch{t: t, pending: make(map[seriesID]cumulative)}
+	batch.lock(cumulativeSeries(req))
+
+	for _, rm := range req.ResourceMetrics {
+		for _, sm := range rm.ScopeMetrics {
+			for _, metric := range sm.Metrics {
+				if metric.Name == "" {
+					batch.Release()
+					return nil, fmt.Errorf("metric without name")
+				}
+				switch {
+				case metric.Sum != nil && metric.Sum.IsMonotonic:
+					for _, dp := range metric.Sum.DataPoints {
+						if m, ok := batch.counter(metric.Name, metric.Sum.AggregationTemporality, rm.Resource, dp); ok {
+							batch.Metrics = append(batch.Metrics, m)
+						}
+					}
+				case metric.Sum != nil:
+					batch.Metrics = appendGauges(batch.Metrics, metric.Name, rm.Resource, metric.Sum.DataPoints)
+				case metric.Gauge != nil:
+					batch.Metrics = appendGauges(batch.Metrics, metric.Name, rm.Resource, metric.Gauge.DataPoints)
+				case metric.Histogram != nil:
+					for _, dp := range metric.Histogram.DataPoints {
+						m, ok, err := batch.histogram(metric.Name, metric.Histogram.AggregationTemporality, rm.Resource, dp)
+						if err != nil {
+							batch.Release()
+							return nil, fmt.Errorf("metric %q: %w", metric.Name, err)
+						}
+						if ok {
+							batch.Metrics = append(batch.Metrics, m)
+						}
+					}
+				}
+			}
+		}
+	}
+	return batch, nil
+}
+
+func (b *Batch) Commit() {
+	b.t.mu.Lock()
+	defer b.t.mu.Unlock()
+	for id, state := range b.pending {
+		b.t.last[id] = state
+	}
+	b.pending = nil
+}
+
+func (b *Batch) Release() {
+	for i := len(b.stripes) - 1; i >= 0; i-- {
+		b.t.stripes[b.stripes[i]].Unlock()
+	}
+	b.stripes = nil
+}
+
+// lock takes the stripe locks of all series in ascending order, so concurrent batches cannot deadlock.
+func (b *Batch) lock(series []seriesID) {
+	for _, id := range series {
+		h := fnv.New32a()
+		h.Write([]byte(id.mType + ":" + id.key))
+		b.stripes = append(b.stripes, int(h.Sum32()%lockStripes))
+	}
+	slices.Sort(b.stripes)
+	b.stripes = slices.Compact(b.stripes)
+	for _, stripe := range b.stripes {
+		b.t.stripes[stripe].Lock()
+	}
+}
+
+func cumulativeSeries(req ExportRequest) []seriesID {
+	var series []seriesID
+	for _, rm := range req.ResourceMetrics {
+		for _, sm := range rm.ScopeMetrics {
+			for _, metric := range sm.Metrics {
+				switch {
+				case metric.Sum != nil && metric.Sum.IsMonotonic && metric.Sum.AggregationTemporality == temporalityCumulative:
+					for _, dp := range metric.Sum.DataPoints {
+						series = append(series, seriesID{models.Counter, models.SeriesKey(metric.Name, labels(rm.Resource, dp.Attributes))})
+					}
+				case metric.Histogram != nil && metric.Histogram.AggregationTemporality == temporalityCumulative:
+					for _, dp := range metric.Histogram.DataPoints {
+						series = append(series, seriesID{models.Histogram, models.SeriesKey(metric.Name, labels(rm.Resource, dp.Attributes))})
+					}
+				}
+			}
+		}
+	}
+	return series
+}
+
+// previous returns the baseline of a series, including points earlier in the same batch.
+func (b *Batch) previous(id seriesID) (cumulative, bool) {
+	if state, ok := b.pending[id]; ok {
+		return state, true
+	}
+	b.t.mu.Lock()
+	defer b.t.mu.Unlock()
+	state, ok := b.t.last[id]
+	return state, ok
+}
+
+// Forget drops the baselines of matching series, e.g. after they were deleted from storage.
+func (t *Translator) Forget(match func(mType, key string) bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id := range t.last {
+		if match(id.mType, id.key) {
+			delete(t.last, id)
+		}
+	}
+}
+
+// Prune drops the baselines of series not seen since before.
+func (t *Translator) Prune(before time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id, state := range t.last {
+		if state.seen.Before(before) {
+			delete(t.last, id)
+		}
+	}
+}
+
+func labels(resource Resource, attributes []KeyValue) map[string]string {
+	if len(resource.Attributes) == 0 && len(attributes) == 0 {
+		return nil
+	}
+	result := make(map[string]string, len(resource.Attributes)+len(attributes))
+	for _, attr := range resource.Attributes {
+		result[labelName(attr.Key)] = attr.Value.String()
+	}
+	for _, attr := range attributes {
+		result[labelName(attr.Key)] = attr.Value.String()
+	}
+	return result
+}
+
+// labelName maps attribute keys such as "service.name" to valid label names the
+// way Prometheus does, replacing other characters with underscores.
+func labelName(key string) string {
+	if models.ValidLabelName(key) {
+		return key
+	}
+	var b strings.Builder
+	for i, r := range key {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteRune('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
+
+func appendGauges(metrics []models.Metric, name string, resource Resource, points []NumberDataPoint) []models.Metric {
+	for _, dp := range points {
+		value, ok := dp.value()
+		if !ok {
+			continue
+		}
+		metrics = append(metrics, models.Metric{
+			ID:     name,
+			MType:  models.Gauge,
+			Value:  &value,
+			Labels: labels(resource, dp.Attributes),
+		})
+	}
+	return metrics
+}
+
+func (b *Batch) counter(name string, temporality int, resource Resource, dp NumberDataPoint) (models.Metric, bool) {
+	value, ok := dp.value()
+	if !ok {
+		return models.Metric{}, false
+	}
+	metric := models.Metric{ID: name, MType: models.Counter, Labels: labels(resource, dp.Attributes)}
+	total := int64(math.Round(value))
+	delta := total
+
+	if temporality == temporalityCumulative {
+		id := seriesID{models.Counter, metric.Key()}
+		prev, seen := b.previous(id)
+		if seen && prev.start == uint64(dp.StartTimeUnixNano) && uint64(dp.TimeUnixNano) != 0 && uint64(dp.TimeUnixNano) <= prev.time {
+			// An older point arriving late must not be mistaken for a reset.
+			return models.Metric{}, false
+		}
+		b.pending[id] = cumulative{start: uint64(dp.StartTimeUnixNano), time: uint64(dp.TimeUnixNano), total: total, seen: time.Now()}
+		switch {
+		case !seen && !b.t.startedAfterTranslator(dp.StartTimeUnixNano):
+			// The series may have been counted before a restart, use this point as the baseline.
+			return models.Metric{}, false
+		case seen && prev.start == uint64(dp.StartTimeUnixNano) && total >= prev.total:
+			delta = total - prev.total
+		}
+	}
+	metric.Delta = &delta
+	return metric, true
+}
+
+func (b *Batch) histogram(name string, temporality int, resource Resource, dp HistogramDataPoint) (models.Metric, bool, error) {
+	if dp.Flags&flagNoRecordedValue != 0 {
+		return models.Metric{}, false, nil
+	}
+	value, err := histogramValue(dp)
+	if err != nil {
+		return models.Metric{}, false, err
+	}
+	metric := models.Metric{ID: name, MType: models.Histogram, Labels: labels(resource, dp.Attributes)}
+
+	if temporality == temporalityCumulative {
+		id := seriesID{models.Histogram, metric.Key()}
+		prev, seen := b.previous(id)
+		if seen && prev.start == uint64(dp.StartTimeUnixNano) && uint64(dp.TimeUnixNano) != 0 && uint64(dp.TimeUnixNano) <= prev.time {
+			return models.Metric{}, false, nil
+		}
+		b.pending[id] = cumulative{start: uint64(dp.StartTimeUnixNano), time: uint64(dp.TimeUnixNano), histogram: value, seen: time.Now()}
+		switch {
+		case !seen && !b.t.startedAfterTranslator(dp.StartTimeUnixNano):
+			return models.Metric{}, false, nil
+		case seen && prev.start == uint64(dp.StartTimeUnixNano):
+			if delta, ok := subtract(value, prev.histogram); ok {
+				value = delta
+			}
+		}
+	}
+	metric.Histogram = &value
+	return metric, true, nil
+}
+
+func (t *Translator) startedAfterTranslator(start Uint) bool {
+	return start != 0 && int64(start) > t.started.UnixNano()
+}
+
+// histogramValue converts per-bucket OTLP counts into cumulative buckets.
+func histogramValue(dp HistogramDataPoint) (models.HistogramValue, error) {
+	value := models.HistogramValue{Count: uint64(dp.Count)}
+	if dp.Sum != nil {
+		value.Sum = float64(*dp.Sum)
+	}
+	if len(dp.BucketCounts) == 0 {
+		return value, value.Validate()
+	}
+	if len(dp.BucketCounts) != len(dp.ExplicitBounds)+1 {
+		return models.HistogramValue{}, fmt.Errorf("expected %d bucket counts, got %d", len(dp.ExplicitBounds)+1, len(dp.BucketCounts))
+	}
+	var cumulativeCount uint64
+	for i, bound := range dp.ExplicitBounds {
+		cumulativeCount += uint64(dp.BucketCounts[i])
+		value.Buckets = append(value.Buckets, models.Bucket{UpperBound: float64(bound), Count: cumulativeCount})
+	}
+	return value, value.Validate()
+}
+
+// subtract returns current minus prev, or false if the layouts differ or any count went down.
+func subtract(current, prev models.HistogramValue) (models.HistogramValue, bool) {
+	if len(current.Buckets) != len(prev.Buckets) || current.Count < prev.Count {
+		return models.HistogramValue{}, false
+	}
+	delta := current.Clone()
+	for i := range delta.Buckets {
+		if delta.Buckets[i].UpperBound != prev.Buckets[i].UpperBound || delta.Buckets[i].Count < prev.Buckets[i].Count {
+			return models.HistogramValue{}, false
+		}
+		delta.Buckets[i].Count -= prev.Buckets[i].Count
+	}
+	delta.Count -= prev.Count
+	delta.Sum -= prev.Sum
+	return delta, true
+}
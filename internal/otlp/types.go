@@ -0,0 +1,155 @@
+package otlp
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// The types below cover the subset of the OTLP ExportMetricsServiceRequest
+// JSON encoding this server understands. Unsupported metric kinds such as
+// exponential histograms and summaries are ignored.
+
+const (
+	temporalityDelta      = 1
+	temporalityCumulative = 2
+
+	flagNoRecordedValue = 1
+)
+
+type ExportRequest struct {
+	ResourceMetrics []ResourceMetrics `json:"resourceMetrics"`
+}
+
+type ResourceMetrics struct {
+	Resource     Resource       `json:"resource"`
+	ScopeMetrics []ScopeMetrics `json:"scopeMetrics"`
+}
+
+type Resource struct {
+	Attributes []KeyValue `json:"attributes"`
+}
+
+type ScopeMetrics struct {
+	Metrics []Metric `json:"metrics"`
+}
+
+type Metric struct {
+	Name      string     `json:"name"`
+	Sum       *Sum       `json:"sum"`
+	Gauge     *Gauge     `json:"gauge"`
+	Histogram *Histogram `json:"histogram"`
+}
+
+type Sum struct {
+	DataPoints             []NumberDataPoint `json:"dataPoints"`
+	AggregationTemporality int               `json:"aggregationTemporality"`
+	IsMonotonic            bool              `json:"isMonotonic"`
+}
+
+type Gauge struct {
+	DataPoints []NumberDataPoint `json:"dataPoints"`
+}
+
+type Histogram struct {
+	DataPoints             []HistogramDataPoint `json:"dataPoints"`
+	AggregationTemporality int                  `json:"aggregationTemporality"`
+}
+
+type NumberDataPoint struct {
+	Attributes        []KeyValue `json:"attributes"`
+	StartTimeUnixNano Uint       `json:"startTimeUnixNano"`
+	TimeUnixNano      Uint       `json:"timeUnixNano"`
+	AsDouble          *Float     `json:"asDouble"`
+	AsInt             *Int       `json:"asInt"`
+	Flags             uint32     `json:"flags"`
+}
+
+func (dp NumberDataPoint) value() (float64, bool) {
+	switch {
+	case dp.Flags&flagNoRecordedValue != 0:
+		return 0, false
+	case dp.AsInt != nil:
+		return float64(*dp.AsInt), true
+	case dp.AsDouble != nil && !math.IsNaN(float64(*dp.AsDouble)) && !math.IsInf(float64(*dp.AsDouble), 0):
+		return float64(*dp.AsDouble), true
+	default:
+		return 0, false
+	}
+}
+
+type HistogramDataPoint struct {
+	Attributes        []KeyValue `json:"attributes"`
+	StartTimeUnixNano Uint       `json:"startTimeUnixNano"`
+	TimeUnixNano      Uint       `json:"timeUnixNano"`
+	Count             Uint       `json:"count"`
+	Sum               *Float     `json:"sum"`
+	BucketCounts      []Uint     `json:"bucketCounts"`
+	ExplicitBounds    []Float    `json:"explicitBounds"`
+	Flags             uint32     `json:"flags"`
+}
+
+type KeyValue struct {
+	Key   string   `json:"key"`
+	Value AnyValue `json:"value"`
+}
+
+type AnyValue struct {
+	StringValue *string         `json:"stringValue"`
+	BoolValue   *bool           `json:"boolValue"`
+	IntValue    *Int            `json:"intValue"`
+	DoubleValue *Float          `json:"doubleValue"`
+	ArrayValue  json.RawMessage `json:"arrayValue"`
+	KvlistValue json.RawMessage `json:"kvlistValue"`
+}
+
+// String renders the value as a label value; arrays and maps are kept as their JSON encoding.
+func (v AnyValue) String() string {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return strconv.FormatBool(*v.BoolValue)
+	case v.IntValue != nil:
+		return strconv.FormatInt(int64(*v.IntValue), 10)
+	case v.DoubleValue != nil:
+		return strconv.FormatFloat(float64(*v.DoubleValue), 'f', -1, 64)
+	case v.ArrayValue != nil:
+		return string(v.ArrayValue)
+	case v.KvlistValue != nil:
+		return string(v.KvlistValue)
+	default:
+		return ""
+	}
+}
+
+// Int, Uint and Float accept both JSON numbers and the quoted form the
+// protobuf JSON mapping uses for 64-bit integers and non-finite floats.
+type (
+	Int   int64
+	Uint  uint64
+	Float float64
+)
+
+func unquote(data []byte) string {
+	return strings.Trim(string(data), `"`)
+}
+
+func (i *Int) UnmarshalJSON(data []byte) error {
+	v, err := strconv.ParseInt(unquote(data), 10, 64)
+	*i = Int(v)
+	return err
+}
+
+func (u *Uint) UnmarshalJSON(data []byte) error {
+	v, err := strconv.ParseUint(unquote(data), 10, 64)
+	*u = Uint(v)
+	return err
+}
+
+func (f *Float) UnmarshalJSON(data []byte) error {
+	v, err := strconv.ParseFloat(unquote(data), 64)
+	*f = Float(v)
+	return err
+}
@@ -0,0 +1,121 @@
+package prometheus
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type Sample struct {
+	Name   string
+	Type   string
+	Labels map[string]string
+	Value  float64
+}
+
+func SanitizeName(name string) string {
+	if name == "" {
+		return "_"
+	}
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteRune('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+func SanitizeLabelName(name string) string {
+	return strings.ReplaceAll(SanitizeName(name), ":", "_")
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func FormatValue(value float64) string {
+	switch {
+	case math.IsNaN(value):
+		return "NaN"
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
+
+func FormatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, SanitizeLabelName(k), escapeLabelValue(labels[k])))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func WriteText(w io.Writer, samples []Sample) error {
+	sort.SliceStable(samples, func(i, j int) bool {
+		nameI, nameJ := SanitizeName(samples[i].Name), SanitizeName(samples[j].Name)
+		if nameI != nameJ {
+			return nameI < nameJ
+		}
+		if samples[i].Type != samples[j].Type {
+			return samples[i].Type < samples[j].Type
+		}
+		labelsI, labelsJ := FormatLabels(samples[i].Labels), FormatLabels(samples[j].Labels)
+		if labelsI != labelsJ {
+			return labelsI < labelsJ
+		}
+		return samples[i].Name < samples[j].Name
+	})
+
+	// Names can collide after sanitizing; a family has one type, so the first one wins.
+	types := make(map[string]string)
+	lastSeries := ""
+	for _, s := range samples {
+		name := SanitizeName(s.Name)
+		familyType, declared := types[name]
+		if declared && familyType != s.Type {
+			continue
+		}
+		if !declared {
+			if _, err := fmt.Fprintf(w, "# TYPE %s %s\n", name, s.Type); err != nil {
+				return err
+			}
+			types[name] = s.Type
+		}
+		series := name + FormatLabels(s.Labels)
+		if series == lastSeries {
+			continue
+		}
+		lastSeries = series
+		if _, err := fmt.Fprintf(w, "%s %s\n", series, FormatValue(s.Value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package prometheus
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+	TypeSummary   = "summary"
+	TypeUntyped   = "untyped"
+)
+
+// ParseText parses the Prometheus text exposition format. Each sample gets the
+// type declared by the "# TYPE" line of its family, histogram and summary
+// series such as name_bucket and name_count included; samples without a
+// declared type are untyped. Timestamps are ignored.
+func ParseText(r io.Reader) ([]Sample, error) {
+	types := make(map[string]string)
+	var samples []Sample
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) == 4 && fields[1] == "TYPE" {
+				types[fields[2]] = fields[3]
+			}
+			continue
+		}
+
+		sample, err := parseSample(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		sample.Type = familyType(types, sample.Name)
+		samples = append(samples, sample)
+	}
+	return samples, scanner.Err()
+}
+
+func familyType(types map[string]string, name string) string {
+	if t, ok := types[name]; ok {
+		return t
+	}
+	for _, suffix := range []string{"_bucket", "_count", "_sum"} {
+		if family, found := strings.CutSuffix(name, suffix); found {
+			if t := types[family]; t == TypeHistogram || t == TypeSummary {
+				return t
+			}
+		}
+	}
+	return TypeUntyped
+}
+
+func parseSample(line string) (Sample, error) {
+	end := strings.IndexAny(line, "{ \t")
+	if end <= 0 {
+		return Sample{}, errors.New("missing metric name or value")
+	}
+	sample := Sample{Name: line[:end]}
+	rest := line[end:]
+
+	if strings.HasPrefix(rest, "{") {
+		labels, n, err := parseLabels(rest)
+		if err != nil {
+			return Sample{}, err
+		}
+		sample.Labels = labels
+		rest = rest[n:]
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) < 1 || len(fields) > 2 {
+		return Sample{}, errors.New("expected value and optional timestamp")
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return Sample{}, fmt.Errorf("invalid value %q", fields[0])
+	}
+	sample.Value = value
+	return sample, nil
+}
+
+// parseLabels parses `{name="value",...}` at the start of s and returns the number of bytes consumed.
+func parseLabels(s string) (map[string]string, int, error) {
+	labels := make(map[string]string)
+	i := 1
+	for {
+		for i < len(s) && (s[i] == ' ' || s[i] == ',') {
+			i++
+		}
+		if i >= len(s) {
+			return nil, 0, errors.New("unterminated label set")
+		}
+		if s[i] == '}' {
+			return labels, i + 1, nil
+		}
+
+		eq := strings.IndexByte(s[i:], '=')
+		if eq <= 0 {
+			return nil, 0, errors.New("invalid label")
+		}
+		name := strings.TrimSpace(s[i : i+eq])
+		i += eq + 1
+		if i >= len(s) || s[i] != '"' {
+			return nil, 0, fmt.Errorf("label %q: value must be quoted", name)
+		}
+
+		var value strings.Builder
+		closed := false
+		for i++; i < len(s); i++ {
+			c := s[i]
+			if c == '"' {
+				closed = true
+				i++
+				break
+			}
+			if c == '\\' && i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					c = '\n'
+				default:
+					c = s[i]
+				}
+			}
+			value.WriteByte(c)
+		}
+		if !closed {
+			return nil, 0, fmt.Errorf("label %q: unterminated value", name)
+		}
+		labels[name] = value.String()
+	}
+}
@@ -0,0 +1,45 @@
+package prometheus
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseText(t *testing.T) {
+	text := `# HELP http_requests_total Requests served.
+# TYPE http_requests_total counter
+http_requests_total{code="200",path="/a\"b\\c"} 1027 1395066363000
+http_requests_total{code="500",} 3
+# TYPE queue gauge
+queue 2.5
+# TYPE latency histogram
+latency_bucket{le="0.1"} 4
+latency_bucket{le="+Inf"} 6
+latency_sum 1.7
+latency_count 6
+free_form NaN
+`
+	samples, err := ParseText(strings.NewReader(text))
+	require.NoError(t, err)
+	require.Len(t, samples, 8)
+
+	require.Equal(t, Sample{
+		Name:   "http_requests_total",
+		Type:   TypeCounter,
+		Labels: map[string]string{"code": "200", "path": `/a"b\c`},
+		Value:  1027,
+	}, samples[0])
+	require.Equal(t, map[string]string{"code": "500"}, samples[1].Labels)
+	require.Equal(t, TypeGauge, samples[2].Type)
+	require.Equal(t, TypeHistogram, samples[4].Type)
+	require.Equal(t, "+Inf", samples[4].Labels["le"])
+	require.Equal(t, TypeHistogram, samples[6].Type)
+	require.Equal(t, TypeUntyped, samples[7].Type)
+
+	for _, invalid := range []string{"metric", `metric{code="200" 1`, `metric{code=200} 1`, "metric one", "metric 1 2 3"} {
+		_, err := ParseText(strings.NewReader(invalid))
+		require.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,178 @@
+package prometheus
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Metric types from the remote_write MetricMetadata enum.
+const (
+	MetadataCounter   = 1
+	MetadataGauge     = 2
+	MetadataHistogram = 3
+	MetadataSummary   = 5
+)
+
+// WriteRequest is the subset of prometheus.WriteRequest (remote_write 1.0)
+// this server uses; exemplars and native histograms are skipped.
+type WriteRequest struct {
+	Timeseries []TimeSeries
+	Metadata   []MetricMetadata
+}
+
+type TimeSeries struct {
+	Labels  map[string]string
+	Samples []RemoteSample
+}
+
+type RemoteSample struct {
+	Value     float64
+	Timestamp int64
+}
+
+type MetricMetadata struct {
+	Type             int
+	MetricFamilyName string
+}
+
+// DecodeWriteRequest decodes a snappy-compressed protobuf WriteRequest.
+func DecodeWriteRequest(body []byte) (WriteRequest, error) {
+	data, err := snappy.Decode(nil, body)
+	if err != nil {
+		return WriteRequest{}, fmt.Errorf("snappy: %w", err)
+	}
+	var req WriteRequest
+	err = walkMessage(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			series, err := decodeTimeSeries(value)
+			if err != nil {
+				return fmt.Errorf("timeseries: %w", err)
+			}
+			req.Timeseries = append(req.Timeseries, series)
+		case num == 3 && typ == protowire.BytesType:
+			metadata, err := decodeMetadata(value)
+			if err != nil {
+				return fmt.Errorf("metadata: %w", err)
+			}
+			req.Metadata = append(req.Metadata, metadata)
+		}
+		return nil
+	})
+	return req, err
+}
+
+func decodeTimeSeries(data []byte) (TimeSeries, error) {
+	series := TimeSeries{Labels: make(map[string]string)}
+	err := walkMessage(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			var name, labelValue string
+			err := walkMessage(value, func(num protowire.Number, typ protowire.Type, value []byte) error {
+				if typ != protowire.BytesType {
+					return nil
+				}
+				switch num {
+				case 1:
+					name = string(value)
+				case 2:
+					labelValue = string(value)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			series.Labels[name] = labelValue
+		case num == 2 && typ == protowire.BytesType:
+			var sample RemoteSample
+			err := walkMessage(value, func(num protowire.Number, typ protowire.Type, value []byte) error {
+				switch {
+				case num == 1 && typ == protowire.Fixed64Type:
+					bits, _ := protowire.ConsumeFixed64(value)
+					sample.Value = math.Float64frombits(bits)
+				case num == 2 && typ == protowire.VarintType:
+					v, _ := protowire.ConsumeVarint(value)
+					sample.Timestamp = int64(v)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			series.Samples = append(series.Samples, sample)
+		}
+		return nil
+	})
+	return series, err
+}
+
+func decodeMetadata(data []byte) (MetricMetadata, error) {
+	var metadata MetricMetadata
+	err := walkMessage(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			v, _ := protowire.ConsumeVarint(value)
+			metadata.Type = int(v)
+		case num == 2 && typ == protowire.BytesType:
+			metadata.MetricFamilyName = string(value)
+		}
+		return nil
+	})
+	return metadata, err
+}
+
+// walkMessage calls fn for every field of a protobuf message. For length-delimited
+// fields value is the payload, for other types it is the raw encoded value.
+func walkMessage(data []byte, fn func(num protowire.Number, typ protowire.Type, value []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		var value []byte
+		if typ == protowire.BytesType {
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			value, data = v, data[n:]
+		} else {
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			value, data = data[:n], data[n:]
+		}
+		if err := fn(num, typ, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var errMissingName = errors.New("series without __name__ label")
+
+// SplitName removes __name__ from the series labels and returns it.
+func (s TimeSeries) SplitName() (string, map[string]string, error) {
+	name := s.Labels["__name__"]
+	if name == "" {
+		return "", nil, errMissingName
+	}
+	labels := make(map[string]string, len(s.Labels)-1)
+	for k, v := range s.Labels {
+		if k != "__name__" {
+			labels[k] = v
+		}
+	}
+	if len(labels) == 0 {
+		labels = nil
+	}
+	return name, labels, nil
+}
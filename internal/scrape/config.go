@@ -0,0 +1,81 @@
+package scrape
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+)
+
+const maxTimeout = 10 * time.Second
+
+type Target struct {
+	Job      string
+	Instance string
+	URL      string
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+type jobConfig struct {
+	Job      string   `json:"job"`
+	Targets  []string `json:"targets"`
+	Interval string   `json:"interval"`
+	Timeout  string   `json:"timeout"`
+}
+
+// LoadTargets reads a JSON list of jobs, e.g.
+//
+//	[{"job": "node", "targets": ["http://10.0.0.1:9100/metrics"], "interval": "30s", "timeout": "5s"}]
+//
+// Jobs without an interval use defaultInterval; the timeout defaults to the
+// interval, capped at 10s.
+func LoadTargets(path string, defaultInterval time.Duration) ([]Target, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []jobConfig
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return nil, fmt.Errorf("failed to decode scrape config: %w", err)
+	}
+
+	var targets []Target
+	for _, job := range jobs {
+		if job.Job == "" {
+			return nil, fmt.Errorf("scrape job name is required")
+		}
+		interval := defaultInterval
+		if job.Interval != "" {
+			if interval, err = time.ParseDuration(job.Interval); err != nil {
+				return nil, fmt.Errorf("job %q: invalid interval: %w", job.Job, err)
+			}
+		}
+		if interval <= 0 {
+			return nil, fmt.Errorf("job %q: interval must be positive", job.Job)
+		}
+		timeout := min(interval, maxTimeout)
+		if job.Timeout != "" {
+			if timeout, err = time.ParseDuration(job.Timeout); err != nil || timeout <= 0 {
+				return nil, fmt.Errorf("job %q: invalid timeout %q", job.Job, job.Timeout)
+			}
+		}
+
+		for _, rawURL := range job.Targets {
+			parsed, err := url.Parse(rawURL)
+			if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				return nil, fmt.Errorf("job %q: invalid target URL %q", job.Job, rawURL)
+			}
+			targets = append(targets, Target{
+				Job:      job.Job,
+				Instance: parsed.Host,
+				URL:      rawURL,
+				Interval: interval,
+				Timeout:  timeout,
+			})
+		}
+	}
+	return targets, nil
+}
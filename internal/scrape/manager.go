@@ -0,0 +1,240 @@
+package scrape
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/alisaviation/monitoring/internal/logger"
+	"github.com/alisaviation/monitoring/internal/models"
+	"github.com/alisaviation/monitoring/internal/prometheus"
+)
+
+const (
+	HealthUnknown = "unknown"
+	HealthUp      = "up"
+	HealthDown    = "down"
+
+	acceptHeader = "text/plain;version=0.0.4;q=1,*/*;q=0.1"
+)
+
+type Status struct {
+	Job            string     `json:"job"`
+	Instance       string     `json:"instance"`
+	URL            string     `json:"url"`
+	Health         string     `json:"health"`
+	LastScrape     *time.Time `json:"last_scrape,omitempty"`
+	LastDuration   float64    `json:"last_duration_seconds"`
+	LastError      string     `json:"last_error,omitempty"`
+	SamplesScraped int        `json:"samples_scraped"`
+}
+
+// StoreFunc stores one scrape as a batch; counters carry the cumulative value in Delta.
+type StoreFunc func(ctx context.Context, metrics []models.Metric) error
+
+type Manager struct {
+	store   StoreFunc
+	targets []Target
+	client  *http.Client
+	status  map[string]*Status
+	mu      sync.Mutex
+}
+
+func NewManager(store StoreFunc, targets []Target) *Manager {
+	status := make(map[string]*Status, len(targets))
+	for _, target := range targets {
+		status[target.URL] = &Status{
+			Job:      target.Job,
+			Instance: target.Instance,
+			URL:      redactURL(target.URL),
+			Health:   HealthUnknown,
+		}
+	}
+	return &Manager{
+		store:   store,
+		targets: targets,
+		client:  &http.Client{},
+		status:  status,
+	}
+}
+
+// Run scrapes every target on its own interval until ctx is cancelled.
+func (m *Manager) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, target := range m.targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(target.Interval)
+			defer ticker.Stop()
+			for {
+				m.Scrape(ctx, target)
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (m *Manager) Targets() []Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	statuses := make([]Status, 0, len(m.status))
+	for _, status := range m.status {
+		statuses = append(statuses, *status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Job != statuses[j].Job {
+			return statuses[i].Job < statuses[j].Job
+		}
+		return statuses[i].URL < statuses[j].URL
+	})
+	return statuses
+}
+
+// Scrape fetches one target, stores its samples and an "up" gauge, and records the outcome.
+func (m *Manager) Scrape(ctx context.Context, target Target) {
+	start := time.Now()
+	samples, err := m.scrape(ctx, target)
+	duration := time.Since(start)
+
+	up := 0.0
+	var metrics []models.Metric
+	if err == nil {
+		up = 1
+		metrics = scrapeMetrics(target, samples)
+	}
+	metrics = append(metrics, models.Metric{
+		ID:     "up",
+		MType:  models.Gauge,
+		Value:  &up,
+		Labels: map[string]string{"job": target.Job, "instance": target.Instance},
+	})
+	if storeErr := m.store(ctx, metrics); storeErr != nil && err == nil {
+		err = storeErr
+	}
+
+	m.mu.Lock()
+	status := m.status[target.URL]
+	status.LastScrape = &start
+	status.LastDuration = duration.Seconds()
+	status.SamplesScraped = len(samples)
+	if err != nil {
+		status.Health = HealthDown
+		status.LastError = err.Error()
+	} else {
+		status.Health = HealthUp
+		status.LastError = ""
+	}
+	m.mu.Unlock()
+
+	if err != nil && ctx.Err() == nil {
+		logger.Log.Warn("Scrape failed", zap.String("job", target.Job), zap.String("url", redactURL(target.URL)), zap.Error(err))
+	}
+}
+
+func (m *Manager) scrape(ctx context.Context, target Target) ([]prometheus.Sample, error) {
+	ctx, cancel := context.WithTimeout(ctx, target.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", acceptHeader)
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return prometheus.ParseText(resp.Body)
+}
+
+// scrapeMetrics converts samples into a batch for StoreFunc, so the stored counter
+// follows the target and drops with it on a reset. Histogram and summary _bucket and
+// _count series are counters too, everything else is a gauge.
+func scrapeMetrics(target Target, samples []prometheus.Sample) []models.Metric {
+	metrics := make([]models.Metric, 0, len(samples)+1)
+	for _, sample := range samples {
+		if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) || strings.ContainsAny(sample.Name, "{}") {
+			continue
+		}
+		metric := models.Metric{ID: sample.Name, Labels: targetLabels(target, sample.Labels)}
+		if !validLabels(metric.Labels) {
+			continue
+		}
+		if isCounter(sample) {
+			total := int64(math.Round(sample.Value))
+			metric.MType = models.Counter
+			metric.Delta = &total
+		} else {
+			value := sample.Value
+			metric.MType = models.Gauge
+			metric.Value = &value
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics
+}
+
+func validLabels(labels map[string]string) bool {
+	for name := range labels {
+		if !models.ValidLabelName(name) {
+			return false
+		}
+	}
+	return true
+}
+
+func isCounter(sample prometheus.Sample) bool {
+	switch sample.Type {
+	case prometheus.TypeCounter:
+		return true
+	case prometheus.TypeHistogram, prometheus.TypeSummary:
+		return strings.HasSuffix(sample.Name, "_bucket") || strings.HasSuffix(sample.Name, "_count")
+	default:
+		return false
+	}
+}
+
+// targetLabels adds the job and instance labels; labels of the same name
+// exposed by the target are kept as exported_job and exported_instance.
+func targetLabels(target Target, labels map[string]string) map[string]string {
+	result := make(map[string]string, len(labels)+2)
+	for k, v := range labels {
+		if k == "job" || k == "instance" {
+			k = "exported_" + k
+		}
+		result[k] = v
+	}
+	result["job"] = target.Job
+	result["instance"] = target.Instance
+	return result
+}
+
+// redactURL drops credentials from target URLs shown in /api/targets and logs.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+	u.User = nil
+	return u.String()
+}
@@ -0,0 +1,21 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/alisaviation/monitoring/internal/alerting"
+)
+
+func (p *Server) GetAlerts(w http.ResponseWriter, r *http.Request) {
+	alerts := []alerting.Alert{}
+	if p.Alerts != nil {
+		alerts = p.Alerts.Alerts()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(alerts); err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/alisaviation/monitoring/internal/models"
+	"github.com/alisaviation/monitoring/internal/storage"
+)
+
+func (p *Server) DeleteValue(w http.ResponseWriter, r *http.Request) {
+	name := models.SeriesKey(chi.URLParam(r, "name"), models.ParseLabels(r.URL.Query().Get("labels")))
+	reset, _ := strconv.ParseBool(r.URL.Query().Get("reset"))
+
+	var err error
+	mType := chi.URLParam(r, "type")
+	switch {
+	case mType == models.Gauge && !reset:
+		err = p.Storage.DeleteGauge(r.Context(), name)
+	case mType == models.Counter && reset:
+		err = p.Storage.ResetCounter(r.Context(), name)
+	case mType == models.Counter:
+		err = p.Storage.DeleteCounter(r.Context(), name)
+	case mType == models.Histogram && !reset:
+		err = p.Storage.DeleteHistogram(r.Context(), name)
+	case mType == models.Summary && !reset:
+		err = p.Storage.DeleteSummary(r.Context(), name)
+	case reset && models.ValidType(mType):
+		http.Error(w, "Bad Request: reset only applies to counters", http.StatusBadRequest)
+		return
+	default:
+		http.Error(w, "Bad Request: invalid metric type", http.StatusBadRequest)
+		return
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	p.otlp.Forget(func(forgetType, key string) bool {
+		return forgetType == mType && key == name
+	})
+	w.WriteHeader(http.StatusOK)
+}
+
+func (p *Server) DeleteMetrics(w http.ResponseWriter, r *http.Request) {
+	var filter storage.DeleteFilter
+	if err := json.NewDecoder(r.Body).Decode(&filter); err != nil {
+		http.Error(w, "Bad Request: invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if filter.Type != "" && !models.ValidType(filter.Type) {
+		http.Error(w, "Bad Request: invalid metric type", http.StatusBadRequest)
+		return
+	}
+	if filter.Prefix == "" && len(filter.Labels) == 0 {
+		http.Error(w, "Bad Request: prefix or labels required", http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := p.Storage.DeleteMetrics(r.Context(), filter)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	p.otlp.Forget(filter.Match)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]int{"deleted": deleted}); err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"sort"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/alisaviation/monitoring/internal/helpers"
+	"github.com/alisaviation/monitoring/internal/models"
+	pb "github.com/alisaviation/monitoring/internal/proto"
+	"github.com/alisaviation/monitoring/internal/storage"
+)
+
+const DefaultWatchInterval = time.Second
+
+type GRPCServer struct {
+	pb.UnimplementedMetricsServer
+	server        *Server
+	watchInterval time.Duration
+}
+
+func NewGRPCServer(server *Server) *GRPCServer {
+	return &GRPCServer{
+		server:        server,
+		watchInterval: DefaultWatchInterval,
+	}
+}
+
+func (g *GRPCServer) UpdateMetrics(ctx context.Context, req *pb.UpdateMetricsRequest) (*pb.UpdateMetricsResponse, error) {
+	if len(req.GetMetrics()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "empty metrics batch")
+	}
+
+	metrics := make([]models.Metric, 0, len(req.GetMetrics()))
+	for _, m := range req.GetMetrics() {
+		metric := metricFromProto(m)
+		if err := validateMetric(metric); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		metrics = append(metrics, metric)
+	}
+
+	if err := g.server.applyBatch(ctx, metrics); err != nil {
+		if g.server.Storage.IsUniqueViolationError(err) {
+			return nil, status.Error(codes.AlreadyExists, "unique violation")
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	updated, err := g.server.getUpdatedMetrics(ctx, metrics)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	resp := &pb.UpdateMetricsResponse{Metrics: make([]*pb.Metric, 0, len(updated))}
+	for _, metric := range updated {
+		resp.Metrics = append(resp.Metrics, metricToProto(metric))
+	}
+	return resp, nil
+}
+
+func (g *GRPCServer) GetMetric(ctx context.Context, req *pb.GetMetricRequest) (*pb.GetMetricResponse, error) {
+	metric := models.Metric{ID: req.GetId(), MType: req.GetType(), Labels: req.GetLabels()}
+
+	switch metric.MType {
+	case models.Gauge:
+		value, err := g.server.Storage.GetGauge(ctx, metric.Key())
+		if err != nil {
+			return nil, storageStatus(err)
+		}
+		metric.Value = value
+	case models.Counter:
+		delta, err := g.server.Storage.GetCounter(ctx, metric.Key())
+		if err != nil {
+			return nil, storageStatus(err)
+		}
+		metric.Delta = delta
+	default:
+		return nil, status.Error(codes.InvalidArgument, "invalid metric type")
+	}
+
+	return &pb.GetMetricResponse{Metric: metricToProto(metric)}, nil
+}
+
+func (g *GRPCServer) ListMetrics(ctx context.Context, req *pb.ListMetricsRequest) (*pb.ListMetricsResponse, error) {
+	metrics, err := g.server.listMetrics(ctx, req.GetLabels())
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	resp := &pb.ListMetricsResponse{Metrics: make([]*pb.Metric, 0, len(metrics))}
+	for _, metric := range metrics {
+		resp.Metrics = append(resp.Metrics, metricToProto(metric))
+	}
+	return resp, nil
+}
+
+func (g *GRPCServer) Watch(req *pb.WatchRequest, stream pb.Metrics_WatchServer) error {
+	ticker := time.NewTicker(g.watchInterval)
+	defer ticker.Stop()
+
+	last := make(map[string]models.Metric)
+	for {
+		metrics, err := g.server.listMetrics(stream.Context(), req.GetLabels())
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+
+		for _, metric := range metrics {
+			id := metric.MType + ":" + metric.Key()
+			if prev, seen := last[id]; seen && sameValue(prev, metric) {
+				continue
+			}
+			if err := stream.Send(metricToProto(metric)); err != nil {
+				return err
+			}
+			last[id] = metric
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Server) listMetrics(ctx context.Context, filter map[string]string) ([]models.Metric, error) {
+	gauges, err := p.Storage.Gauges(ctx)
+	if err != nil {
+		return nil, err
+	}
+	counters, err := p.Storage.Counters(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := make([]models.Metric, 0, len(gauges)+len(counters))
+	for key, value := range gauges {
+		id, labels := models.ParseSeriesKey(key)
+		if !models.MatchLabels(labels, filter) {
+			continue
+		}
+		metrics = append(metrics, models.Metric{ID: id, MType: models.Gauge, Value: &value, Labels: labels})
+	}
+	for key, delta := range counters {
+		id, labels := models.ParseSeriesKey(key)
+		if !models.MatchLabels(labels, filter) {
+			continue
+		}
+		metrics = append(metrics, models.Metric{ID: id, MType: models.Counter, Delta: &delta, Labels: labels})
+	}
+
+	sort.Slice(metrics, func(i, j int) bool {
+		if metrics[i].MType != metrics[j].MType {
+			return metrics[i].MType < metrics[j].MType
+		}
+		return metrics[i].Key() < metrics[j].Key()
+	})
+	return metrics, nil
+}
+
+func sameValue(a, b models.Metric) bool {
+	switch {
+	case a.Value != nil && b.Value != nil:
+		return *a.Value == *b.Value
+	case a.Delta != nil && b.Delta != nil:
+		return *a.Delta == *b.Delta
+	default:
+		return false
+	}
+}
+
+func storageStatus(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return status.Error(codes.NotFound, "metric not found")
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func metricFromProto(m *pb.Metric) models.Metric {
+	return models.Metric{
+		ID:     m.GetId(),
+		MType:  m.GetType(),
+		Delta:  m.Delta,
+		Value:  m.Value,
+		Labels: m.GetLabels(),
+	}
+}
+
+func metricToProto(m models.Metric) *pb.Metric {
+	return &pb.Metric{
+		Id:     m.ID,
+		Type:   m.MType,
+		Delta:  m.Delta,
+		Value:  m.Value,
+		Labels: m.Labels,
+	}
+}
+
+func TrustedSubnetInterceptor(subnet *net.IPNet) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if subnet == nil || info.FullMethod != pb.Metrics_UpdateMetrics_FullMethodName {
+			return handler(ctx, req)
+		}
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		values := md.Get(helpers.RealIPMetadataKey)
+		if len(values) == 0 {
+			return nil, status.Error(codes.PermissionDenied, "missing real ip")
+		}
+		if ip := net.ParseIP(values[0]); ip == nil || !subnet.Contains(ip) {
+			return nil, status.Error(codes.PermissionDenied, "ip is not in trusted subnet")
+		}
+		return handler(ctx, req)
+	}
+}
+
+func SyncSaveInterceptor(storeInterval time.Duration, storage storage.Storage) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		if err != nil || storeInterval != 0 || info.FullMethod != pb.Metrics_UpdateMetrics_FullMethodName {
+			return resp, err
+		}
+		if err := storage.Save(); err != nil {
+			return nil, status.Error(codes.Internal, "failed to save metrics")
+		}
+		return resp, nil
+	}
+}
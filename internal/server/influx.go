@@ -0,0 +1,69 @@
+package server
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/alisaviation/monitoring/internal/influx"
+	"github.com/alisaviation/monitoring/internal/models"
+)
+
+// WriteInflux accepts InfluxDB line protocol. Each field becomes the metric
+// <measurement>_<field> labelled with the point tags: integer fields are
+// counter deltas, everything else is a gauge. Point timestamps are checked
+// but otherwise ignored: samples are recorded at arrival time, as on every
+// other write path.
+func (p *Server) WriteInflux(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Bad Request: failed to read body", http.StatusBadRequest)
+		return
+	}
+	points, err := influx.Parse(body, r.URL.Query().Get("precision"))
+	if err != nil {
+		http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	metrics := influxMetrics(points)
+	if len(metrics) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	for _, metric := range metrics {
+		if err := validateMetric(metric); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := p.applyBatch(r.Context(), metrics); err != nil {
+		if p.Storage.IsUniqueViolationError(err) {
+			http.Error(w, "Conflict: unique violation", http.StatusConflict)
+		} else {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func influxMetrics(points []influx.Point) []models.Metric {
+	var metrics []models.Metric
+	for _, point := range points {
+		for _, field := range point.Fields {
+			metric := models.Metric{ID: point.Measurement + "_" + field.Key, Labels: point.Tags}
+			if field.Integer {
+				delta := field.Int
+				metric.MType = models.Counter
+				metric.Delta = &delta
+			} else {
+				value := field.Float
+				metric.MType = models.Gauge
+				metric.Value = &value
+			}
+			metrics = append(metrics, metric)
+		}
+	}
+	return metrics
+}
@@ -12,24 +12,21 @@ import (
 
 	"github.com/alisaviation/monitoring/internal/helpers"
 	"github.com/alisaviation/monitoring/internal/models"
+	"github.com/alisaviation/monitoring/internal/storage"
 )
 
-func updateMetricInTx(tx *sql.Tx, metric models.Metric) error {
+func updateMetricInTx(ctx context.Context, tx *sql.Tx, metric models.Metric) error {
 	switch metric.MType {
 	case models.Gauge:
-		_, err := tx.Exec(`
-            INSERT INTO gauges (name, value)
-            VALUES ($1, $2)
-            ON CONFLICT (name) DO UPDATE SET value = EXCLUDED.value
-        `, metric.ID, *metric.Value)
+		_, err := tx.ExecContext(ctx, storage.UpsertGaugeQuery, metric.Key(), *metric.Value)
 		return err
 	case models.Counter:
-		_, err := tx.Exec(`
-            INSERT INTO counters (name, value)
-            VALUES ($1, $2)
-            ON CONFLICT (name) DO UPDATE SET value = counters.value + EXCLUDED.value
-        `, metric.ID, *metric.Delta)
+		_, err := tx.ExecContext(ctx, storage.UpsertCounterQuery, metric.Key(), *metric.Delta)
 		return err
+	case models.Histogram:
+		return storage.AddHistogramTx(ctx, tx, metric.Key(), *metric.Histogram)
+	case models.Summary:
+		return storage.SetSummaryTx(ctx, tx, metric.Key(), *metric.Summary)
 	default:
 		return fmt.Errorf("invalid metric type")
 	}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/alisaviation/monitoring/internal/otlp"
+)
+
+// ReceiveOTLP implements the OTLP/HTTP metrics export endpoint with JSON encoding.
+func (p *Server) ReceiveOTLP(w http.ResponseWriter, r *http.Request) {
+	if strings.Contains(r.Header.Get("Content-Type"), "protobuf") {
+		http.Error(w, "Unsupported Media Type: only JSON encoding is supported", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var req otlp.ExportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request: invalid JSON", http.StatusBadRequest)
+		return
+	}
+	batch, err := p.otlp.Translate(req)
+	if err != nil {
+		http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer batch.Release()
+
+	metrics := batch.Metrics
+	for _, metric := range metrics {
+		if err := validateMetric(metric); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if len(metrics) > 0 {
+		if err := p.applyBatch(r.Context(), metrics); err != nil {
+			if p.Storage.IsUniqueViolationError(err) {
+				http.Error(w, "Conflict: unique violation", http.StatusConflict)
+			} else {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+	}
+	batch.Commit()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("{}"))
+}
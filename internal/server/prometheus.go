@@ -0,0 +1,60 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/alisaviation/monitoring/internal/models"
+	"github.com/alisaviation/monitoring/internal/prometheus"
+)
+
+func (p *Server) PrometheusMetrics(w http.ResponseWriter, r *http.Request) {
+	gauges, err := p.Storage.Gauges(r.Context())
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	counters, err := p.Storage.Counters(r.Context())
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	filter := models.ParseLabels(r.URL.Query().Get("labels"))
+	samples := make([]prometheus.Sample, 0, len(gauges)+len(counters))
+	for key, value := range gauges {
+		if sample, ok := p.prometheusSample(key, models.Gauge, value, filter); ok {
+			samples = append(samples, sample)
+		}
+	}
+	for key, value := range counters {
+		if sample, ok := p.prometheusSample(key, models.Counter, float64(value), filter); ok {
+			samples = append(samples, sample)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := prometheus.WriteText(&buf, samples); err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", prometheus.ContentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+func (p *Server) prometheusSample(key, mType string, value float64, filter map[string]string) (prometheus.Sample, bool) {
+	name, labels := models.ParseSeriesKey(key)
+	if !models.MatchLabels(labels, filter) {
+		return prometheus.Sample{}, false
+	}
+
+	merged := make(map[string]string, len(p.MetricsLabels)+len(labels))
+	for k, v := range p.MetricsLabels {
+		merged[k] = v
+	}
+	for k, v := range labels {
+		merged[k] = v
+	}
+	return prometheus.Sample{Name: name, Type: mType, Labels: merged, Value: value}, true
+}
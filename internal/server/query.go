@@ -0,0 +1,225 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alisaviation/monitoring/internal/models"
+)
+
+const (
+	defaultQueryRange = time.Hour
+	defaultQueryStep  = time.Minute
+	maxQueryPoints    = 11000
+)
+
+type QueryRangeResponse struct {
+	Name   string            `json:"name"`
+	MType  string            `json:"type"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Fn     string            `json:"fn"`
+	Step   string            `json:"step"`
+	Points []models.Sample   `json:"points"`
+}
+
+func (p *Server) QueryRange(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	name := query.Get("name")
+	mType := query.Get("type")
+	fn := query.Get("fn")
+	if fn == "" {
+		fn = "avg"
+	}
+
+	if name == "" {
+		http.Error(w, "Bad Request: name is required", http.StatusBadRequest)
+		return
+	}
+	if mType != models.Gauge && mType != models.Counter {
+		http.Error(w, "Bad Request: invalid metric type", http.StatusBadRequest)
+		return
+	}
+	aggregate, ok := aggregations[fn]
+	if !ok {
+		http.Error(w, "Bad Request: unsupported fn", http.StatusBadRequest)
+		return
+	}
+	if (fn == "rate" || fn == "increase") && mType != models.Counter {
+		http.Error(w, "Bad Request: "+fn+" is only supported for counters", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	to, err := parseQueryTime(query.Get("to"), now)
+	if err != nil {
+		http.Error(w, "Bad Request: invalid to", http.StatusBadRequest)
+		return
+	}
+	from, err := parseQueryTime(query.Get("from"), to.Add(-defaultQueryRange))
+	if err != nil {
+		http.Error(w, "Bad Request: invalid from", http.StatusBadRequest)
+		return
+	}
+	step, err := parseQueryStep(query.Get("step"))
+	if err != nil {
+		http.Error(w, "Bad Request: invalid step", http.StatusBadRequest)
+		return
+	}
+	if !from.Before(to) {
+		http.Error(w, "Bad Request: from must be before to", http.StatusBadRequest)
+		return
+	}
+	if to.Sub(from)/step > maxQueryPoints {
+		http.Error(w, "Bad Request: too many points, increase step", http.StatusBadRequest)
+		return
+	}
+
+	labels := models.ParseLabels(query.Get("labels"))
+	key := models.SeriesKey(name, labels)
+	samples, err := p.Storage.Samples(r.Context(), mType, key, from, to)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	response := QueryRangeResponse{
+		Name:   name,
+		MType:  mType,
+		Labels: labels,
+		Fn:     fn,
+		Step:   step.String(),
+		Points: aggregateSamples(samples, from, to, step, aggregate),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+type aggregateFunc func(bucket []models.Sample, prev *models.Sample, step time.Duration) float64
+
+var aggregations = map[string]aggregateFunc{
+	"avg": func(bucket []models.Sample, _ *models.Sample, _ time.Duration) float64 {
+		sum := 0.0
+		for _, s := range bucket {
+			sum += s.Value
+		}
+		return sum / float64(len(bucket))
+	},
+	"min": func(bucket []models.Sample, _ *models.Sample, _ time.Duration) float64 {
+		result := math.Inf(1)
+		for _, s := range bucket {
+			result = math.Min(result, s.Value)
+		}
+		return result
+	},
+	"max": func(bucket []models.Sample, _ *models.Sample, _ time.Duration) float64 {
+		result := math.Inf(-1)
+		for _, s := range bucket {
+			result = math.Max(result, s.Value)
+		}
+		return result
+	},
+	"sum": func(bucket []models.Sample, _ *models.Sample, _ time.Duration) float64 {
+		sum := 0.0
+		for _, s := range bucket {
+			sum += s.Value
+		}
+		return sum
+	},
+	"last": func(bucket []models.Sample, _ *models.Sample, _ time.Duration) float64 {
+		return bucket[len(bucket)-1].Value
+	},
+	"count": func(bucket []models.Sample, _ *models.Sample, _ time.Duration) float64 {
+		return float64(len(bucket))
+	},
+	"increase": increase,
+	"rate": func(bucket []models.Sample, prev *models.Sample, step time.Duration) float64 {
+		return increase(bucket, prev, step) / step.Seconds()
+	},
+}
+
+func increase(bucket []models.Sample, prev *models.Sample, _ time.Duration) float64 {
+	total := 0.0
+	for i, s := range bucket {
+		var before *models.Sample
+		if i > 0 {
+			before = &bucket[i-1]
+		} else {
+			before = prev
+		}
+		if before == nil {
+			continue
+		}
+		if s.Value >= before.Value {
+			total += s.Value - before.Value
+		} else {
+			total += s.Value
+		}
+	}
+	return total
+}
+
+func aggregateSamples(samples []models.Sample, from, to time.Time, step time.Duration, aggregate aggregateFunc) []models.Sample {
+	points := make([]models.Sample, 0)
+	var prev *models.Sample
+	idx := 0
+
+	for start := from; !start.After(to); start = start.Add(step) {
+		end := start.Add(step)
+		first := idx
+		for idx < len(samples) && samples[idx].Timestamp.Before(end) {
+			idx++
+		}
+		bucket := samples[first:idx]
+		if len(bucket) == 0 {
+			continue
+		}
+		points = append(points, models.Sample{
+			Timestamp: start,
+			Value:     aggregate(bucket, prev, step),
+		})
+		prev = &samples[idx-1]
+	}
+	return points
+}
+
+func parseQueryTime(value string, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Unix(0, int64(seconds*float64(time.Second))), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func parseQueryStep(value string) (time.Duration, error) {
+	if value == "" {
+		return defaultQueryStep, nil
+	}
+	step, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, convErr := strconv.ParseFloat(value, 64)
+		if convErr != nil {
+			return 0, err
+		}
+		step = time.Duration(seconds * float64(time.Second))
+	}
+	if step <= 0 {
+		return 0, fmt.Errorf("step must be positive")
+	}
+	return step, nil
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/alisaviation/monitoring/internal/models"
+	"github.com/alisaviation/monitoring/internal/prometheus"
+	"github.com/alisaviation/monitoring/internal/storage"
+)
+
+// RemoteWrite receives Prometheus remote_write 1.0 requests. Only the latest
+// sample of each series is stored: storage stamps samples with the arrival
+// time, so older samples from the same request would only add history points
+// with the wrong timestamp. Counters lose nothing, since the latest cumulative
+// value includes every earlier increment.
+func (p *Server) RemoteWrite(w http.ResponseWriter, r *http.Request) {
+	if contentType := r.Header.Get("Content-Type"); contentType != "" &&
+		(!strings.HasPrefix(contentType, "application/x-protobuf") || strings.Contains(contentType, "io.prometheus.write.v2")) {
+		http.Error(w, "Unsupported Media Type: only remote_write 1.0 is supported", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Bad Request: failed to read body", http.StatusBadRequest)
+		return
+	}
+	req, err := prometheus.DecodeWriteRequest(body)
+	if err != nil {
+		http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, metadata := range req.Metadata {
+		p.remoteWriteTypes.Store(metadata.MetricFamilyName, metadata.Type)
+	}
+
+	metrics, err := remoteWriteMetrics(req.Timeseries, p.isRemoteCounter)
+	if err != nil {
+		http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, metric := range metrics {
+		if err := validateMetric(metric); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if len(metrics) > 0 {
+		if err := p.StoreCumulative(r.Context(), metrics); err != nil {
+			if p.Storage.IsUniqueViolationError(err) {
+				http.Error(w, "Conflict: unique violation", http.StatusConflict)
+			} else {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// remoteWriteMetrics returns counters with the cumulative source value in Delta.
+func remoteWriteMetrics(timeseries []prometheus.TimeSeries, isCounter func(name string) bool) ([]models.Metric, error) {
+	var metrics []models.Metric
+	for _, series := range timeseries {
+		name, labels, err := series.SplitName()
+		if err != nil {
+			return nil, err
+		}
+		if len(series.Samples) == 0 {
+			continue
+		}
+		latest := series.Samples[0]
+		for _, sample := range series.Samples[1:] {
+			if sample.Timestamp >= latest.Timestamp {
+				latest = sample
+			}
+		}
+		// Staleness markers are NaN.
+		if math.IsNaN(latest.Value) || math.IsInf(latest.Value, 0) {
+			continue
+		}
+
+		metric := models.Metric{ID: name, Labels: labels}
+		if isCounter(name) {
+			total := int64(math.Round(latest.Value))
+			metric.MType = models.Counter
+			metric.Delta = &total
+		} else {
+			value := latest.Value
+			metric.MType = models.Gauge
+			metric.Value = &value
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics, nil
+}
+
+// StoreCumulative stores a batch whose counters carry the cumulative source value in
+// Delta. Each counter grows by the increase since the previous source value; a value
+// below it is a counter reset, so the whole value is added and the counter keeps
+// increasing. Postgres does that in a single statement per series and one
+// transaction per batch, so HA Prometheus replicas cannot race.
+func (p *Server) StoreCumulative(ctx context.Context, metrics []models.Metric) error {
+	if p.DB != nil {
+		return p.execInTransactionWithRetry(ctx, func(tx *sql.Tx) error {
+			for _, metric := range metrics {
+				var err error
+				if metric.MType == models.Counter {
+					_, err = tx.ExecContext(ctx, storage.CumulativeCounterQuery, metric.Key(), *metric.Delta)
+				} else {
+					err = updateMetricInTx(ctx, tx, metric)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	p.cumulativeMu.Lock()
+	defer p.cumulativeMu.Unlock()
+	if p.cumulative == nil {
+		p.cumulative = make(map[string]int64)
+	}
+	// The batch is applied at the end, so repeated series are compared with the value seen in it.
+	inBatch := make(map[string]bool)
+	for i, metric := range metrics {
+		if metric.MType != models.Counter {
+			continue
+		}
+		key := metric.Key()
+		var previous int64
+		if inBatch[key] {
+			previous = p.cumulative[key]
+		} else {
+			// A counter missing from storage was deleted or never written, so it starts from zero.
+			stored, err := p.Storage.GetCounter(ctx, key)
+			switch {
+			case err == nil:
+				previous = *stored
+				if last, ok := p.cumulative[key]; ok {
+					previous = last
+				}
+			case !errors.Is(err, sql.ErrNoRows):
+				return err
+			}
+		}
+		inBatch[key] = true
+		total := *metric.Delta
+		delta := total - previous
+		if total < previous {
+			delta = total
+		}
+		p.cumulative[key] = total
+		metrics[i].Delta = &delta
+	}
+	return p.applyBatch(ctx, metrics)
+}
+
+// isRemoteCounter uses the metadata Prometheus sends periodically and falls back to naming conventions.
+func (p *Server) isRemoteCounter(name string) bool {
+	if metadataType, ok := p.remoteWriteTypes.Load(name); ok {
+		return metadataType.(int) == prometheus.MetadataCounter
+	}
+	for _, suffix := range []string{"_bucket", "_count"} {
+		family, found := strings.CutSuffix(name, suffix)
+		if !found {
+			continue
+		}
+		if metadataType, ok := p.remoteWriteTypes.Load(family); ok {
+			return metadataType.(int) == prometheus.MetadataHistogram || metadataType.(int) == prometheus.MetadataSummary
+		}
+	}
+	return strings.HasSuffix(name, "_total") || strings.HasSuffix(name, "_bucket")
+}
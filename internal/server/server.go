@@ -6,26 +6,46 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
+	"github.com/alisaviation/monitoring/internal/alerting"
 	"github.com/alisaviation/monitoring/internal/helpers"
 	"github.com/alisaviation/monitoring/internal/models"
+	"github.com/alisaviation/monitoring/internal/otlp"
+	"github.com/alisaviation/monitoring/internal/scrape"
 	"github.com/alisaviation/monitoring/internal/storage"
 )
 
 type Server struct {
 	Storage storage.Storage
 	DB      *sql.DB
+	Alerts  *alerting.Engine
+	Scrape  *scrape.Manager
+
+	MetricsLabels map[string]string
+	StaleAfter    time.Duration
+
+	otlp *otlp.Translator
+	// remoteWriteTypes maps metric family names to remote_write metadata types.
+	remoteWriteTypes sync.Map
+	cumulativeMu     sync.Mutex
+	// cumulative holds the last cumulative source value of each counter written by StoreCumulative.
+	cumulative map[string]int64
 }
 
 func NewServer(storage storage.Storage, db *sql.DB) *Server {
 	return &Server{
 		Storage: storage,
 		DB:      db,
+		otlp:    otlp.NewTranslator(),
 	}
 }
 
@@ -95,6 +115,10 @@ func (p *Server) UpdateTextMetrics(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Bad Request: invalid metric type", http.StatusBadRequest)
 		return
 	}
+	if err := validateMetric(metric); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	if err := p.updateMetric(r.Context(), metric); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -136,6 +160,14 @@ func (p *Server) GetValue(w http.ResponseWriter, r *http.Request) {
 			if metrics.Delta != nil {
 				response = *metrics.Delta
 			}
+		case models.Histogram:
+			if metrics.Histogram != nil {
+				response = metrics.Histogram.String()
+			}
+		case models.Summary:
+			if metrics.Summary != nil {
+				response = metrics.Summary.String()
+			}
 		}
 	}
 
@@ -157,22 +189,38 @@ func (p *Server) GetJSONValue(ctx context.Context, w http.ResponseWriter, r *htt
 
 	switch metrics.MType {
 	case models.Gauge:
-		value, err := p.Storage.GetGauge(ctx, metrics.ID)
+		value, err := p.Storage.GetGauge(ctx, metrics.Key())
 		if err != nil {
 			http.Error(w, "Not Found  gauge in GetJSONValue", http.StatusNotFound)
 			return models.Metric{}
 		}
 		metrics.Value = value
 	case models.Counter:
-		delta, err := p.Storage.GetCounter(ctx, metrics.ID)
+		delta, err := p.Storage.GetCounter(ctx, metrics.Key())
 		if err != nil {
 			http.Error(w, "Not Found  coutner in GetJSONValue", http.StatusNotFound)
 			return models.Metric{}
 		}
 		metrics.Delta = delta
+	case models.Histogram:
+		histogram, err := p.Storage.GetHistogram(ctx, metrics.Key())
+		if err != nil {
+			http.Error(w, "Not Found histogram in GetJSONValue", http.StatusNotFound)
+			return models.Metric{}
+		}
+		metrics.Histogram = histogram
+	case models.Summary:
+		summary, err := p.Storage.GetSummary(ctx, metrics.Key())
+		if err != nil {
+			http.Error(w, "Not Found summary in GetJSONValue", http.StatusNotFound)
+			return models.Metric{}
+		}
+		metrics.Summary = summary
 	default:
 		http.Error(w, "Bad Request: invalid metric type", http.StatusBadRequest)
+		return metrics
 	}
+	p.annotate(ctx, &metrics)
 	return metrics
 }
 
@@ -197,6 +245,20 @@ func (p *Server) GetTextValue(ctx context.Context, w http.ResponseWriter, r *htt
 			return models.Metric{}
 		}
 		metrics.Delta = delta
+	case models.Histogram:
+		histogram, err := p.Storage.GetHistogram(ctx, metrics.ID)
+		if err != nil {
+			http.Error(w, "Not Found histogram value in GetTextValue", http.StatusNotFound)
+			return models.Metric{}
+		}
+		metrics.Histogram = histogram
+	case models.Summary:
+		summary, err := p.Storage.GetSummary(ctx, metrics.ID)
+		if err != nil {
+			http.Error(w, "Not Found summary value in GetTextValue", http.StatusNotFound)
+			return models.Metric{}
+		}
+		metrics.Summary = summary
 	default:
 		http.Error(w, "Bad Request: invalid metric type", http.StatusBadRequest)
 		return models.Metric{}
@@ -222,30 +284,13 @@ func (p *Server) UpdateBatchMetrics(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	if p.DB != nil {
-		if err := p.execInTransactionWithRetry(r.Context(), func(tx *sql.Tx) error {
-			for _, metric := range metrics {
-				if err := updateMetricInTx(tx, metric); err != nil {
-					return err
-				}
-			}
-			return nil
-		}); err != nil {
-			if p.Storage.IsUniqueViolationError(err) {
-				http.Error(w, "Conflict: unique violation", http.StatusConflict)
-			} else {
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			}
-			return
-		}
-	}
-	if p.DB == nil {
-		for _, metric := range metrics {
-			if err := p.updateMetric(r.Context(), metric); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
+	if err := p.applyBatch(r.Context(), metrics); err != nil {
+		if p.Storage.IsUniqueViolationError(err) {
+			http.Error(w, "Conflict: unique violation", http.StatusConflict)
+		} else {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		}
+		return
 	}
 	updatedMetrics, err := p.getUpdatedMetrics(r.Context(), metrics)
 	if err != nil {
@@ -265,17 +310,54 @@ func (p *Server) GetMetricsList(w http.ResponseWriter, r *http.Request) {
 
 	response.WriteString("<html><body><h1>Metrics</h1><ul>")
 
+	filter := models.ParseLabels(r.URL.Query().Get("labels"))
+
+	now := time.Now()
 	gauges, err := p.Storage.Gauges(r.Context())
 	if err == nil {
+		updated := p.updateTimes(r.Context(), models.Gauge)
 		for name, value := range gauges {
-			response.WriteString(fmt.Sprintf("<li>%s: %s</li>", name, helpers.FormatFloat(value)))
+			if _, labels := models.ParseSeriesKey(name); !models.MatchLabels(labels, filter) {
+				continue
+			}
+			response.WriteString(fmt.Sprintf("<li>%s: %s%s</li>", html.EscapeString(name), helpers.FormatFloat(value),
+				p.staleMarker(updated, name, now)))
 		}
 	}
 
 	counters, err := p.Storage.Counters(r.Context())
 	if err == nil {
+		updated := p.updateTimes(r.Context(), models.Counter)
 		for name, value := range counters {
-			response.WriteString(fmt.Sprintf("<li>%s: %d</li>", name, value))
+			if _, labels := models.ParseSeriesKey(name); !models.MatchLabels(labels, filter) {
+				continue
+			}
+			response.WriteString(fmt.Sprintf("<li>%s: %d%s</li>", html.EscapeString(name), value,
+				p.staleMarker(updated, name, now)))
+		}
+	}
+
+	histograms, err := p.Storage.Histograms(r.Context())
+	if err == nil {
+		updated := p.updateTimes(r.Context(), models.Histogram)
+		for name, value := range histograms {
+			if _, labels := models.ParseSeriesKey(name); !models.MatchLabels(labels, filter) {
+				continue
+			}
+			response.WriteString(fmt.Sprintf("<li>%s: %s%s</li>", html.EscapeString(name), html.EscapeString(value.String()),
+				p.staleMarker(updated, name, now)))
+		}
+	}
+
+	summaries, err := p.Storage.Summaries(r.Context())
+	if err == nil {
+		updated := p.updateTimes(r.Context(), models.Summary)
+		for name, value := range summaries {
+			if _, labels := models.ParseSeriesKey(name); !models.MatchLabels(labels, filter) {
+				continue
+			}
+			response.WriteString(fmt.Sprintf("<li>%s: %s%s</li>", html.EscapeString(name), html.EscapeString(value.String()),
+				p.staleMarker(updated, name, now)))
 		}
 	}
 
@@ -290,12 +372,12 @@ func (p *Server) GetMetricsList(w http.ResponseWriter, r *http.Request) {
 func (p *Server) respondWithMetric(ctx context.Context, w http.ResponseWriter, metric models.Metric) {
 	switch metric.MType {
 	case models.Gauge:
-		value, err := p.Storage.GetGauge(ctx, metric.ID)
+		value, err := p.Storage.GetGauge(ctx, metric.Key())
 		if err != nil {
 			metric.Value = value
 		}
 	case models.Counter:
-		delta, err := p.Storage.GetCounter(ctx, metric.ID)
+		delta, err := p.Storage.GetCounter(ctx, metric.Key())
 		if err != nil {
 			metric.Delta = delta
 		}
@@ -309,9 +391,13 @@ func (p *Server) respondWithMetric(ctx context.Context, w http.ResponseWriter, m
 func (p *Server) updateMetric(ctx context.Context, metric models.Metric) error {
 	switch metric.MType {
 	case models.Gauge:
-		return p.Storage.SetGauge(ctx, metric.ID, *metric.Value)
+		return p.Storage.SetGauge(ctx, metric.Key(), *metric.Value)
 	case models.Counter:
-		return p.Storage.AddCounter(ctx, metric.ID, *metric.Delta)
+		return p.Storage.AddCounter(ctx, metric.Key(), *metric.Delta)
+	case models.Histogram:
+		return p.Storage.AddHistogram(ctx, metric.Key(), *metric.Histogram)
+	case models.Summary:
+		return p.Storage.SetSummary(ctx, metric.Key(), *metric.Summary)
 	default:
 		return &helpers.HTTPError{
 			StatusCode: http.StatusBadRequest,
@@ -320,16 +406,60 @@ func (p *Server) updateMetric(ctx context.Context, metric models.Metric) error {
 	}
 }
 
+func (p *Server) applyBatch(ctx context.Context, metrics []models.Metric) error {
+	if p.DB != nil {
+		return p.execInTransactionWithRetry(ctx, func(tx *sql.Tx) error {
+			for _, metric := range metrics {
+				if err := updateMetricInTx(ctx, tx, metric); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	for _, metric := range metrics {
+		if err := p.updateMetric(ctx, metric); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func validateMetric(metric models.Metric) error {
+	if strings.ContainsAny(metric.ID, "{}") {
+		return errors.New("bad Request: invalid metric id")
+	}
+	for name := range metric.Labels {
+		if !models.ValidLabelName(name) {
+			return fmt.Errorf("bad Request: invalid label name %q", name)
+		}
+	}
 	switch metric.MType {
 	case models.Gauge:
 		if metric.Value == nil {
 			return errors.New("bad Request: value is required for gauge")
 		}
+		if math.IsNaN(*metric.Value) || math.IsInf(*metric.Value, 0) {
+			return errors.New("bad Request: gauge value must be finite")
+		}
 	case models.Counter:
 		if metric.Delta == nil {
 			return errors.New("bad Request: delta is required for counter")
 		}
+	case models.Histogram:
+		if metric.Histogram == nil {
+			return errors.New("bad Request: histogram is required for histogram")
+		}
+		if err := metric.Histogram.Validate(); err != nil {
+			return fmt.Errorf("bad Request: invalid histogram: %w", err)
+		}
+	case models.Summary:
+		if metric.Summary == nil {
+			return errors.New("bad Request: summary is required for summary")
+		}
+		if err := metric.Summary.Validate(); err != nil {
+			return fmt.Errorf("bad Request: invalid summary: %w", err)
+		}
 	default:
 		return errors.New("bad Request: invalid metric type")
 	}
@@ -342,23 +472,37 @@ func (p *Server) getUpdatedMetrics(ctx context.Context, metrics []models.Metric)
 		var updatedMetric models.Metric
 		updatedMetric.ID = metric.ID
 		updatedMetric.MType = metric.MType
+		updatedMetric.Labels = metric.Labels
 
 		switch metric.MType {
 		case models.Gauge:
-			value, err := p.Storage.GetGauge(ctx, metric.ID)
+			value, err := p.Storage.GetGauge(ctx, metric.Key())
 			if err != nil {
 				return nil, err
 			}
 			updatedMetric.Value = value
 		case models.Counter:
-			delta, err := p.Storage.GetCounter(ctx, metric.ID)
+			delta, err := p.Storage.GetCounter(ctx, metric.Key())
 			if err != nil {
 				return nil, err
 			}
 			updatedMetric.Delta = delta
+		case models.Histogram:
+			histogram, err := p.Storage.GetHistogram(ctx, metric.Key())
+			if err != nil {
+				return nil, err
+			}
+			updatedMetric.Histogram = histogram
+		case models.Summary:
+			summary, err := p.Storage.GetSummary(ctx, metric.Key())
+			if err != nil {
+				return nil, err
+			}
+			updatedMetric.Summary = summary
 		default:
 			return nil, fmt.Errorf("invalid metric type")
 		}
+		p.annotate(ctx, &updatedMetric)
 
 		updatedMetrics = append(updatedMetrics, updatedMetric)
 	}
@@ -6,19 +6,32 @@ import (
 	"context"
 	"encoding/json"
 	"io"
+	"math"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/go-chi/chi/v5"
+	"github.com/golang/snappy"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protowire"
 
+	"github.com/alisaviation/monitoring/internal/alerting"
 	"github.com/alisaviation/monitoring/internal/helpers"
 	"github.com/alisaviation/monitoring/internal/middleware"
 	"github.com/alisaviation/monitoring/internal/models"
+	pb "github.com/alisaviation/monitoring/internal/proto"
 	"github.com/alisaviation/monitoring/internal/storage"
 )
 
@@ -317,6 +330,24 @@ func Test_updateMetrics(t *testing.T) {
 			expectedBody: "Bad Request: invalid counter value",
 			setupMock:    nil,
 		},
+		{
+			name:         "Text Non-Finite Gauge Value",
+			method:       http.MethodPost,
+			url:          "/update/gauge/metric5/NaN",
+			contentType:  "text/plain",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "bad Request: gauge value must be finite",
+			setupMock:    nil,
+		},
+		{
+			name:         "Text Invalid Metric ID",
+			method:       http.MethodPost,
+			url:          "/update/counter/metric6{host=\"a\"}/1",
+			contentType:  "text/plain",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "bad Request: invalid metric id",
+			setupMock:    nil,
+		},
 		{
 			name:         "Text Invalid Metric Type",
 			method:       http.MethodPost,
@@ -373,6 +404,57 @@ func Test_updateMetrics(t *testing.T) {
 	}
 }
 
+func Test_updateMetricsWithLabels(t *testing.T) {
+	memStorage := storage.NewMemStorage("")
+	server := NewServer(memStorage, nil)
+
+	handler := chi.NewRouter()
+	handler.Post("/updates/", server.UpdateBatchMetrics)
+	handler.Post("/value/", server.GetValue)
+	handler.Get("/", server.GetMetricsList)
+
+	body := `[
+		{"id": "HeapAlloc", "type": "gauge", "value": 1, "labels": {"host": "a"}},
+		{"id": "HeapAlloc", "type": "gauge", "value": 2, "labels": {"host": "b", "service": "api"}}
+	]`
+	req := httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	gauges, err := memStorage.Gauges(context.Background())
+	require.NoError(t, err)
+	require.Len(t, gauges, 2)
+	require.Equal(t, 1.0, gauges[`HeapAlloc{host="a"}`])
+	require.Equal(t, 2.0, gauges[`HeapAlloc{host="b",service="api"}`])
+
+	req = httptest.NewRequest(http.MethodPost, "/value/", strings.NewReader(`{"id": "HeapAlloc", "type": "gauge", "labels": {"service": "api", "host": "b"}}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var metric models.Metric
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &metric))
+	require.Equal(t, 2.0, *metric.Value)
+	require.Equal(t, map[string]string{"host": "b", "service": "api"}, metric.Labels)
+	require.NotNil(t, metric.UpdatedAt)
+	require.False(t, metric.Stale)
+
+	req = httptest.NewRequest(http.MethodGet, "/?labels=host=a", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "HeapAlloc{host=&#34;a&#34;}: 1")
+	require.NotContains(t, w.Body.String(), "host=&#34;b&#34;")
+
+	req = httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(`[{"id": "HeapAlloc", "type": "gauge", "value": 1, "labels": {"a=\\"b": "c"}}]`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
 func Test_getValue(t *testing.T) {
 	memStorage := storage.NewMemStorage("")
 	memStorage.SetGauge(context.Background(), "metric1", 123.45)
@@ -395,7 +477,7 @@ func Test_getValue(t *testing.T) {
 			contentType:  "application/json",
 			body:         `{"id": "metric1", "type": "gauge"}`,
 			expectedCode: http.StatusOK,
-			expectedBody: `{"id":"metric1","type":"gauge","value":123.45}`,
+			expectedBody: `{"id":"metric1","type":"gauge","value":123.45,"updated_at":`,
 		},
 		{
 			name:         "JSON Valid Counter Get",
@@ -404,7 +486,7 @@ func Test_getValue(t *testing.T) {
 			contentType:  "application/json",
 			body:         `{"id": "metric2", "type": "counter"}`,
 			expectedCode: http.StatusOK,
-			expectedBody: `{"id":"metric2","type":"counter","delta":100}`,
+			expectedBody: `{"id":"metric2","type":"counter","delta":100,"updated_at":`,
 		},
 		{
 			name:         "JSON Invalid Metric Type",
@@ -592,6 +674,569 @@ func Test_gzipSupport(t *testing.T) {
 	}
 }
 
+func Test_hashMiddleware(t *testing.T) {
+	const key = "secret"
+	memStorage := storage.NewMemStorage("")
+	server := NewServer(memStorage, nil)
+	handler := middleware.HashMiddleware(key)(http.HandlerFunc(server.UpdateBatchMetrics))
+
+	body := []byte(`[{"id":"HeapAlloc","type":"gauge","value":1}]`)
+	tests := []struct {
+		name         string
+		hash         string
+		expectedCode int
+	}{
+		{"Valid Hash", helpers.ComputeHash(body, key), http.StatusOK},
+		{"Wrong Key", helpers.ComputeHash(body, "other"), http.StatusBadRequest},
+		{"Missing Hash", "", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.hash != "" {
+				req.Header.Set(helpers.HashHeader, tt.hash)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			require.Equal(t, tt.expectedCode, w.Code)
+			if tt.expectedCode == http.StatusOK {
+				require.Equal(t, helpers.ComputeHash(w.Body.Bytes(), key), w.Header().Get(helpers.HashHeader))
+			}
+		})
+	}
+}
+
+func Test_trustedSubnetMiddleware(t *testing.T) {
+	_, subnet, err := net.ParseCIDR("192.168.1.0/24")
+	require.NoError(t, err)
+
+	server := NewServer(storage.NewMemStorage(""), nil)
+	handler := chi.NewRouter()
+	handler.With(middleware.TrustedSubnetMiddleware(subnet)).Post("/update/{type}/{name}/{value}", server.UpdateMetrics)
+	handler.Get("/value/{type}/{name}", server.GetValue)
+
+	tests := []struct {
+		name         string
+		method       string
+		url          string
+		realIP       string
+		expectedCode int
+	}{
+		{"Inside Subnet", http.MethodPost, "/update/gauge/HeapAlloc/1", "192.168.1.10", http.StatusOK},
+		{"Outside Subnet", http.MethodPost, "/update/gauge/HeapAlloc/2", "10.0.0.1", http.StatusForbidden},
+		{"Missing Header", http.MethodPost, "/update/gauge/HeapAlloc/3", "", http.StatusForbidden},
+		{"Read Endpoint Open", http.MethodGet, "/value/gauge/HeapAlloc", "10.0.0.1", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			if tt.realIP != "" {
+				req.Header.Set(helpers.RealIPHeader, tt.realIP)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			require.Equal(t, tt.expectedCode, w.Code)
+		})
+	}
+}
+
+func Test_deleteMetrics(t *testing.T) {
+	ctx := context.Background()
+	memStorage := storage.NewMemStorage("")
+	require.NoError(t, memStorage.SetGauge(ctx, "HeapAlloc", 1))
+	require.NoError(t, memStorage.AddCounter(ctx, "PollCount", 5))
+	require.NoError(t, memStorage.SetGauge(ctx, `disk_free{path="/"}`, 10))
+	require.NoError(t, memStorage.SetGauge(ctx, `disk_free{path="/data"}`, 20))
+	require.NoError(t, memStorage.SetGauge(ctx, `cpu{host="a"}`, 30))
+	require.NoError(t, memStorage.AddHistogram(ctx, "latency", *models.NewHistogram([]float64{1})))
+	require.NoError(t, memStorage.SetSummary(ctx, "rpc", models.SummaryValue{Sum: 1, Count: 1}))
+
+	server := NewServer(memStorage, nil)
+	admin := middleware.AdminMiddleware("secret")
+	handler := chi.NewRouter()
+	handler.With(admin).Delete("/value/{type}/{name}", server.DeleteValue)
+	handler.With(admin).Post("/api/admin/delete", server.DeleteMetrics)
+
+	tests := []struct {
+		name         string
+		method       string
+		url          string
+		body         string
+		token        string
+		expectedCode int
+		expectedBody string
+	}{
+		{"Missing Token", http.MethodDelete, "/value/gauge/HeapAlloc", "", "", http.StatusForbidden, ""},
+		{"Wrong Token", http.MethodDelete, "/value/gauge/HeapAlloc", "", "other", http.StatusForbidden, ""},
+		{"Delete Gauge", http.MethodDelete, "/value/gauge/HeapAlloc", "", "secret", http.StatusOK, ""},
+		{"Delete Missing Gauge", http.MethodDelete, "/value/gauge/HeapAlloc", "", "secret", http.StatusNotFound, ""},
+		{"Reset Counter", http.MethodDelete, "/value/counter/PollCount?reset=true", "", "secret", http.StatusOK, ""},
+		{"Reset Gauge", http.MethodDelete, "/value/gauge/HeapAlloc?reset=true", "", "secret", http.StatusBadRequest, ""},
+		{"Delete Histogram", http.MethodDelete, "/value/histogram/latency", "", "secret", http.StatusOK, ""},
+		{"Delete Missing Histogram", http.MethodDelete, "/value/histogram/latency", "", "secret", http.StatusNotFound, ""},
+		{"Delete Summary", http.MethodDelete, "/value/summary/rpc", "", "secret", http.StatusOK, ""},
+		{"Reset Summary", http.MethodDelete, "/value/summary/rpc?reset=true", "", "secret", http.StatusBadRequest, ""},
+		{"Invalid Type", http.MethodDelete, "/value/unknown/PollCount", "", "secret", http.StatusBadRequest, ""},
+		{"Empty Filter", http.MethodPost, "/api/admin/delete", `{}`, "secret", http.StatusBadRequest, ""},
+		{"Bulk By Prefix", http.MethodPost, "/api/admin/delete", `{"type":"gauge","prefix":"disk_"}`, "secret", http.StatusOK, `{"deleted":2}`},
+		{"Bulk By Labels", http.MethodPost, "/api/admin/delete", `{"labels":{"host":"a"}}`, "secret", http.StatusOK, `{"deleted":1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			require.Equal(t, tt.expectedCode, w.Code)
+			if tt.expectedBody != "" {
+				require.JSONEq(t, tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+
+	gauges, err := memStorage.Gauges(ctx)
+	require.NoError(t, err)
+	require.Empty(t, gauges)
+
+	histograms, err := memStorage.Histograms(ctx)
+	require.NoError(t, err)
+	require.Empty(t, histograms)
+	summaries, err := memStorage.Summaries(ctx)
+	require.NoError(t, err)
+	require.Empty(t, summaries)
+
+	counter, err := memStorage.GetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	require.Equal(t, int64(0), *counter)
+}
+
+func Test_getAlerts(t *testing.T) {
+	ctx := context.Background()
+	memStorage := storage.NewMemStorage("")
+	require.NoError(t, memStorage.SetGauge(ctx, "HeapAlloc", 200))
+
+	server := NewServer(memStorage, nil)
+	handler := chi.NewRouter()
+	handler.Get("/api/alerts", server.GetAlerts)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/alerts", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `[]`, w.Body.String())
+
+	rule, err := alerting.ParseRule("HighHeap", "HeapAlloc > 100")
+	require.NoError(t, err)
+	server.Alerts = alerting.NewEngine(memStorage, []alerting.Rule{rule})
+	server.Alerts.Evaluate(ctx, time.Now())
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/alerts", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var alerts []alerting.Alert
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &alerts))
+	require.Len(t, alerts, 1)
+	require.Equal(t, "HighHeap", alerts[0].Rule)
+	require.Equal(t, alerting.StateFiring, alerts[0].State)
+	require.Equal(t, 200.0, alerts[0].Value)
+}
+
+func Test_staleMetrics(t *testing.T) {
+	ctx := context.Background()
+	memStorage := storage.NewMemStorage("")
+	require.NoError(t, memStorage.SetGauge(ctx, "Fresh", 1))
+	require.NoError(t, memStorage.SetGauge(ctx, "Dead", 2))
+
+	server := NewServer(memStorage, nil)
+	server.StaleAfter = 20 * time.Millisecond
+	handler := chi.NewRouter()
+	handler.Get("/", server.GetMetricsList)
+	handler.Post("/value/", server.GetValue)
+
+	time.Sleep(30 * time.Millisecond)
+	require.NoError(t, memStorage.SetGauge(ctx, "Fresh", 3))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Contains(t, w.Body.String(), "Dead: 2 (stale)")
+	require.Contains(t, w.Body.String(), "Fresh: 3</li>")
+
+	req := httptest.NewRequest(http.MethodPost, "/value/", strings.NewReader(`{"id":"Dead","type":"gauge"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	var metric models.Metric
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &metric))
+	require.True(t, metric.Stale)
+
+	sweepCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go server.RunSweeper(sweepCtx, 20*time.Millisecond, 0, 5*time.Millisecond)
+	require.Eventually(t, func() bool {
+		_, err := memStorage.GetGauge(ctx, "Dead")
+		return err != nil
+	}, time.Second, 5*time.Millisecond)
+}
+
+func Test_distributionMetrics(t *testing.T) {
+	server := NewServer(storage.NewMemStorage(""), nil)
+	handler := chi.NewRouter()
+	handler.Post("/updates/", server.UpdateBatchMetrics)
+	handler.Post("/value/", server.GetValue)
+	handler.Get("/value/{type}/{name}", server.GetValue)
+	handler.Get("/", server.GetMetricsList)
+
+	batch := `[
+		{"id":"latency","type":"histogram","histogram":{"buckets":[{"le":0.1,"count":1},{"le":1,"count":3}],"sum":1.2,"count":4}},
+		{"id":"rpc","type":"summary","summary":{"quantiles":[{"quantile":0.5,"value":0.2}],"sum":10,"count":20}}
+	]`
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(batch)))
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	invalid := []string{
+		`[{"id":"latency","type":"histogram"}]`,
+		`[{"id":"latency","type":"histogram","histogram":{"buckets":[{"le":1,"count":3},{"le":0.1,"count":1}],"count":3}}]`,
+		`[{"id":"latency","type":"histogram","histogram":{"buckets":[{"le":0.1,"count":3},{"le":1,"count":1}],"count":3}}]`,
+		`[{"id":"rpc","type":"summary","summary":{"quantiles":[{"quantile":1.5,"value":1}]}}]`,
+	}
+	for _, body := range invalid {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(body)))
+		require.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/value/", strings.NewReader(`{"id":"latency","type":"histogram"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var metric models.Metric
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &metric))
+	require.Equal(t, uint64(8), metric.Histogram.Count)
+	require.Equal(t, 2.4, metric.Histogram.Sum)
+	require.Equal(t, uint64(6), metric.Histogram.Buckets[1].Count)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/value/summary/rpc", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "count=20 sum=10 quantiles={0.5:0.2}", w.Body.String())
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Contains(t, w.Body.String(), "latency: count=8 sum=2.4 buckets={0.1:2,1:6,+Inf:8}")
+	require.Contains(t, w.Body.String(), "rpc: count=20 sum=10 quantiles={0.5:0.2}")
+}
+
+func Test_writeInflux(t *testing.T) {
+	memStorage := storage.NewMemStorage("")
+	server := NewServer(memStorage, nil)
+	handler := chi.NewRouter()
+	handler.Post("/api/v2/write", server.WriteInflux)
+
+	start := time.Now()
+	body := "cpu,host=web01 usage_idle=92.5,requests=3i 1700000000000000000\ncpu,host=web01 requests=2i\n"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v2/write", strings.NewReader(body)))
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	// The point timestamp is ignored, so the sample is recorded at arrival time.
+	samples, err := memStorage.Samples(context.Background(), models.Gauge, `cpu_usage_idle{host="web01"}`, start, time.Now())
+	require.NoError(t, err)
+	require.Len(t, samples, 1)
+	require.Equal(t, 92.5, samples[0].Value)
+
+	value, err := memStorage.GetGauge(context.Background(), `cpu_usage_idle{host="web01"}`)
+	require.NoError(t, err)
+	require.Equal(t, 92.5, *value)
+	delta, err := memStorage.GetCounter(context.Background(), `cpu_requests{host="web01"}`)
+	require.NoError(t, err)
+	require.Equal(t, int64(5), *delta)
+
+	for _, target := range []string{"/api/v2/write", "/api/v2/write?precision=h"} {
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, target, strings.NewReader("cpu usage=1\ncpu usage\n")))
+		require.Equal(t, http.StatusBadRequest, w.Code, target)
+	}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v2/write", strings.NewReader("c{pu} usage=1")))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	server.DB = db
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO gauges").WithArgs("mem_used", 0.5).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO counters").WithArgs("mem_faults", int64(7)).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v2/write", strings.NewReader("mem used=0.5,faults=7i")))
+	require.Equal(t, http.StatusNoContent, w.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func Test_receiveOTLP(t *testing.T) {
+	memStorage := storage.NewMemStorage("")
+	server := NewServer(memStorage, nil)
+	handler := chi.NewRouter()
+	handler.Post("/v1/metrics", server.ReceiveOTLP)
+
+	body := `{"resourceMetrics":[{
+		"resource":{"attributes":[{"key":"host","value":{"stringValue":"web01"}}]},
+		"scopeMetrics":[{"metrics":[
+			{"name":"requests","sum":{"aggregationTemporality":1,"isMonotonic":true,"dataPoints":[{"asInt":"3"}]}},
+			{"name":"load","gauge":{"dataPoints":[{"asDouble":0.7}]}}
+		]}]
+	}]}`
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/metrics", strings.NewReader(body)))
+		require.Equal(t, http.StatusOK, w.Code)
+		require.JSONEq(t, `{}`, w.Body.String())
+	}
+
+	delta, err := memStorage.GetCounter(context.Background(), `requests{host="web01"}`)
+	require.NoError(t, err)
+	require.Equal(t, int64(6), *delta)
+	value, err := memStorage.GetGauge(context.Background(), `load{host="web01"}`)
+	require.NoError(t, err)
+	require.Equal(t, 0.7, *value)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/metrics", strings.NewReader("{")))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/metrics", strings.NewReader(""))
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	require.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+}
+
+type remoteSeries struct {
+	labels []string
+	value  float64
+}
+
+func encodeWriteRequest(series []remoteSeries, counterFamilies ...string) []byte {
+	var req []byte
+	for _, s := range series {
+		var ts []byte
+		for i := 0; i < len(s.labels); i += 2 {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, s.labels[i])
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, s.labels[i+1])
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, label)
+		}
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(time.Now().UnixMilli()))
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, sample)
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, ts)
+	}
+	for _, family := range counterFamilies {
+		var metadata []byte
+		metadata = protowire.AppendTag(metadata, 1, protowire.VarintType)
+		metadata = protowire.AppendVarint(metadata, 1)
+		metadata = protowire.AppendTag(metadata, 2, protowire.BytesType)
+		metadata = protowire.AppendString(metadata, family)
+		req = protowire.AppendTag(req, 3, protowire.BytesType)
+		req = protowire.AppendBytes(req, metadata)
+	}
+	return snappy.Encode(nil, req)
+}
+
+func Test_remoteWrite(t *testing.T) {
+	memStorage := storage.NewMemStorage("")
+	server := NewServer(memStorage, nil)
+	handler := chi.NewRouter()
+	handler.Post("/api/v1/write", server.RemoteWrite)
+
+	write := func(body []byte) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-protobuf")
+		req.Header.Set("Content-Encoding", "snappy")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// A counter family declared by metadata, one by naming convention and a gauge.
+	// The source resets after 25, so 4 and then 6 add 4 and 2.
+	for _, total := range []float64{10, 25, 4, 6} {
+		require.Equal(t, http.StatusNoContent, write(encodeWriteRequest([]remoteSeries{
+			{labels: []string{"__name__", "http_requests_total", "code", "200"}, value: total},
+			{labels: []string{"__name__", "jobs_done"}, value: total * 2},
+			{labels: []string{"__name__", "temperature", "room", "lab"}, value: 21.5},
+			{labels: []string{"__name__", "temperature", "room", "hall"}, value: math.NaN()},
+		}, "jobs_done")))
+	}
+
+	counter, err := memStorage.GetCounter(context.Background(), `http_requests_total{code="200"}`)
+	require.NoError(t, err)
+	require.Equal(t, int64(31), *counter)
+	counter, err = memStorage.GetCounter(context.Background(), "jobs_done")
+	require.NoError(t, err)
+	require.Equal(t, int64(62), *counter)
+	gauge, err := memStorage.GetGauge(context.Background(), `temperature{room="lab"}`)
+	require.NoError(t, err)
+	require.Equal(t, 21.5, *gauge)
+	_, err = memStorage.GetGauge(context.Background(), `temperature{room="hall"}`)
+	require.Error(t, err)
+
+	require.Equal(t, http.StatusBadRequest, write([]byte("not snappy")))
+	require.Equal(t, http.StatusBadRequest, write(encodeWriteRequest([]remoteSeries{{labels: []string{"job", "api"}, value: 1}})))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/write", nil)
+	req.Header.Set("Content-Type", "application/x-protobuf;proto=io.prometheus.write.v2.Request")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	require.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	// With Postgres the increase is computed in the transaction, without a separate read.
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	server.DB = db
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO counters").WithArgs(`http_requests_total{code="200"}`, int64(7)).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO gauges").WithArgs(`temperature{room="lab"}`, 22.0).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	require.Equal(t, http.StatusNoContent, write(encodeWriteRequest([]remoteSeries{
+		{labels: []string{"__name__", "http_requests_total", "code", "200"}, value: 7},
+		{labels: []string{"__name__", "temperature", "room", "lab"}, value: 22},
+	})))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func Test_grpcServer(t *testing.T) {
+	memStorage := storage.NewMemStorage("")
+	srv := NewGRPCServer(NewServer(memStorage, nil))
+	srv.watchInterval = 10 * time.Millisecond
+
+	listener := bufconn.Listen(1024 * 1024)
+	grpcServer := grpc.NewServer()
+	pb.RegisterMetricsServer(grpcServer, srv)
+	go grpcServer.Serve(listener)
+	defer grpcServer.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewMetricsClient(conn)
+	ctx := context.Background()
+
+	_, err = client.UpdateMetrics(ctx, &pb.UpdateMetricsRequest{})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.UpdateMetrics(ctx, &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{
+		{Id: "HeapAlloc", Type: models.Gauge, Value: pointer(math.NaN())},
+	}})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	resp, err := client.UpdateMetrics(ctx, &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{
+		{Id: "HeapAlloc", Type: models.Gauge, Value: pointer(1.5), Labels: map[string]string{"host": "a"}},
+		{Id: "PollCount", Type: models.Counter, Delta: pointer(int64(3))},
+		{Id: "PollCount", Type: models.Counter, Delta: pointer(int64(2))},
+	}})
+	require.NoError(t, err)
+	require.Len(t, resp.GetMetrics(), 3)
+	require.Equal(t, int64(5), resp.GetMetrics()[2].GetDelta())
+
+	got, err := client.GetMetric(ctx, &pb.GetMetricRequest{Id: "HeapAlloc", Type: models.Gauge, Labels: map[string]string{"host": "a"}})
+	require.NoError(t, err)
+	require.Equal(t, 1.5, got.GetMetric().GetValue())
+
+	_, err = client.GetMetric(ctx, &pb.GetMetricRequest{Id: "HeapAlloc", Type: models.Gauge})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	list, err := client.ListMetrics(ctx, &pb.ListMetricsRequest{Labels: map[string]string{"host": "a"}})
+	require.NoError(t, err)
+	require.Len(t, list.GetMetrics(), 1)
+	require.Equal(t, "HeapAlloc", list.GetMetrics()[0].GetId())
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := client.Watch(watchCtx, &pb.WatchRequest{})
+	require.NoError(t, err)
+
+	first, err := stream.Recv()
+	require.NoError(t, err)
+	second, err := stream.Recv()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"HeapAlloc", "PollCount"}, []string{first.GetId(), second.GetId()})
+
+	require.NoError(t, memStorage.AddCounter(ctx, "PollCount", 1))
+	updated, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, "PollCount", updated.GetId())
+	require.Equal(t, int64(6), updated.GetDelta())
+}
+
+func Test_syncSaveInterceptor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	memStorage := storage.NewMemStorage(path)
+	interceptor := SyncSaveInterceptor(0, memStorage)
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, memStorage.SetGauge(ctx, "Alloc", 1)
+	}
+
+	_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: pb.Metrics_GetMetric_FullMethodName}, handler)
+	require.NoError(t, err)
+	require.NoFileExists(t, path)
+
+	_, err = interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: pb.Metrics_UpdateMetrics_FullMethodName}, handler)
+	require.NoError(t, err)
+	require.FileExists(t, path)
+}
+
+func Test_syncSaveMiddleware(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	memStorage := storage.NewMemStorage(path)
+	server := NewServer(memStorage, nil)
+	handler := chi.NewRouter()
+	handler.Use(middleware.SyncSaveMiddleware(0, memStorage))
+	handler.Post("/updates/", server.UpdateBatchMetrics)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(`[{"id":"latency","type":"histogram"}]`)))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.NoFileExists(t, path)
+
+	body := `[{"id":"latency","type":"histogram","histogram":{"buckets":[{"le":1,"count":2}],"sum":1.5,"count":2}}]`
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(body)))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.FileExists(t, path)
+
+	restored := storage.NewMemStorage(path)
+	require.NoError(t, restored.Load())
+	histograms, err := restored.Histograms(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), histograms["latency"].Count)
+}
+
 func testGzipRequest(t *testing.T, srv *Server, method, path, contentType string, body interface{}) {
 	var buf bytes.Buffer
 	gz := gzip.NewWriter(&buf)
@@ -676,6 +1321,98 @@ func testGzipResponse(t *testing.T, srv *Server, method, path, contentType strin
 	require.NoError(t, err)
 }
 
+func Test_queryRange(t *testing.T) {
+	memStorage := storage.NewMemStorage("")
+	memStorage.SetGauge(context.Background(), "HeapAlloc", 10)
+	memStorage.SetGauge(context.Background(), "HeapAlloc", 20)
+	memStorage.AddCounter(context.Background(), "PollCount", 1)
+	server := NewServer(memStorage, nil)
+
+	handler := chi.NewRouter()
+	handler.Get("/api/query_range", server.QueryRange)
+
+	tests := []struct {
+		name         string
+		url          string
+		expectedCode int
+		expectedBody string
+	}{
+		{"Gauge Avg", "/api/query_range?name=HeapAlloc&type=gauge&step=1h", http.StatusOK, `"value":15`},
+		{"Gauge Count", "/api/query_range?name=HeapAlloc&type=gauge&step=1h&fn=count", http.StatusOK, `"value":2`},
+		{"Counter Last", "/api/query_range?name=PollCount&type=counter&step=1h&fn=last", http.StatusOK, `"value":1`},
+		{"Missing Name", "/api/query_range?type=gauge", http.StatusBadRequest, "name is required"},
+		{"Unknown Fn", "/api/query_range?name=HeapAlloc&type=gauge&fn=median", http.StatusBadRequest, "unsupported fn"},
+		{"Rate On Gauge", "/api/query_range?name=HeapAlloc&type=gauge&fn=rate", http.StatusBadRequest, "only supported for counters"},
+		{"Invalid Step", "/api/query_range?name=HeapAlloc&type=gauge&step=-1s", http.StatusBadRequest, "invalid step"},
+		{"Unknown Metric", "/api/query_range?name=Unknown&type=gauge", http.StatusNotFound, "Not Found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			require.Equal(t, tt.expectedCode, w.Code)
+			require.Contains(t, w.Body.String(), tt.expectedBody)
+		})
+	}
+}
+
+func Test_prometheusMetrics(t *testing.T) {
+	memStorage := storage.NewMemStorage("")
+	memStorage.SetGauge(context.Background(), "HeapAlloc", 1.5)
+	memStorage.SetGauge(context.Background(), "1st.gauge-name", 2)
+	memStorage.AddCounter(context.Background(), "PollCount", 7)
+	// Same family as the counter, so the conflicting gauge is skipped.
+	memStorage.SetGauge(context.Background(), "PollCount", 3)
+	server := NewServer(memStorage, nil)
+	server.MetricsLabels = map[string]string{"env": "prod"}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	w := httptest.NewRecorder()
+	server.PrometheusMetrics(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Header().Get("Content-Type"), "text/plain")
+	require.Equal(t, `# TYPE HeapAlloc gauge
+HeapAlloc{env="prod"} 1.5
+# TYPE PollCount counter
+PollCount{env="prod"} 7
+# TYPE _1st_gauge_name gauge
+_1st_gauge_name{env="prod"} 2
+`, w.Body.String())
+}
+
+func Test_aggregateSamples(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	samples := []models.Sample{
+		{Timestamp: start.Add(10 * time.Second), Value: 5},
+		{Timestamp: start.Add(50 * time.Second), Value: 15},
+		{Timestamp: start.Add(70 * time.Second), Value: 3},
+		{Timestamp: start.Add(100 * time.Second), Value: 9},
+	}
+
+	increasePoints := aggregateSamples(samples, start, start.Add(2*time.Minute), time.Minute, aggregations["increase"])
+	require.Len(t, increasePoints, 2)
+	require.Equal(t, 10.0, increasePoints[0].Value)
+	require.Equal(t, 9.0, increasePoints[1].Value)
+
+	ratePoints := aggregateSamples(samples, start, start.Add(2*time.Minute), time.Minute, aggregations["rate"])
+	require.InDelta(t, 0.15, ratePoints[1].Value, 1e-9)
+
+	maxPoints := aggregateSamples(samples, start, start.Add(3*time.Minute), time.Minute, aggregations["max"])
+	require.Len(t, maxPoints, 2)
+	require.Equal(t, 15.0, maxPoints[0].Value)
+	require.Equal(t, start.Add(time.Minute), maxPoints[1].Timestamp)
+
+	// A sample exactly at the end of the range gets a point of its own.
+	samples = append(samples, models.Sample{Timestamp: start.Add(2 * time.Minute), Value: 20})
+	maxPoints = aggregateSamples(samples, start, start.Add(2*time.Minute), time.Minute, aggregations["max"])
+	require.Len(t, maxPoints, 3)
+	require.Equal(t, 20.0, maxPoints[2].Value)
+}
+
 func pointer[T any](v T) *T {
 	return &v
 }
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/alisaviation/monitoring/internal/logger"
+	"github.com/alisaviation/monitoring/internal/models"
+)
+
+func (p *Server) isStale(updated, now time.Time) bool {
+	return p.StaleAfter > 0 && now.Sub(updated) > p.StaleAfter
+}
+
+func (p *Server) annotate(ctx context.Context, metric *models.Metric) {
+	updated, err := p.Storage.LastUpdated(ctx, metric.MType, metric.Key())
+	if err != nil {
+		return
+	}
+	metric.UpdatedAt = &updated
+	metric.Stale = p.isStale(updated, time.Now())
+}
+
+func (p *Server) updateTimes(ctx context.Context, mType string) map[string]time.Time {
+	if p.StaleAfter <= 0 {
+		return nil
+	}
+	updated, err := p.Storage.UpdateTimes(ctx, mType)
+	if err != nil {
+		logger.Log.Warn("Failed to get update times", zap.String("type", mType), zap.Error(err))
+		return nil
+	}
+	return updated
+}
+
+func (p *Server) staleMarker(updated map[string]time.Time, name string, now time.Time) string {
+	if last, exists := updated[name]; exists && p.isStale(last, now) {
+		return " (stale)"
+	}
+	return ""
+}
+
+// RunSweeper deletes series not updated within ttl and samples older than retention;
+// a zero duration disables either.
+func (p *Server) RunSweeper(ctx context.Context, ttl, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if ttl > 0 {
+				p.expireSeries(ctx, now.Add(-ttl))
+			}
+			if retention > 0 {
+				p.pruneSamples(ctx, now.Add(-retention))
+			}
+		}
+	}
+}
+
+func (p *Server) expireSeries(ctx context.Context, before time.Time) {
+	p.otlp.Prune(before)
+	expired, err := p.Storage.ExpireSeries(ctx, before)
+	if err != nil {
+		logger.Log.Error("Failed to expire stale series", zap.Error(err))
+		return
+	}
+	if expired > 0 {
+		logger.Log.Info("Expired stale series", zap.Int("count", expired))
+	}
+}
+
+func (p *Server) pruneSamples(ctx context.Context, before time.Time) {
+	pruned, err := p.Storage.PruneSamples(ctx, before)
+	if err != nil {
+		logger.Log.Error("Failed to prune samples", zap.Error(err))
+		return
+	}
+	if pruned > 0 {
+		logger.Log.Debug("Pruned samples", zap.Int("count", pruned))
+	}
+}
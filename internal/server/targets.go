@@ -0,0 +1,21 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/alisaviation/monitoring/internal/scrape"
+)
+
+func (p *Server) GetTargets(w http.ResponseWriter, r *http.Request) {
+	targets := []scrape.Status{}
+	if p.Scrape != nil {
+		targets = p.Scrape.Targets()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(targets); err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
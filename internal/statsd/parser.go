@@ -0,0 +1,119 @@
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/alisaviation/monitoring/internal/models"
+)
+
+const (
+	TypeCounter      = "c"
+	TypeGauge        = "g"
+	TypeTimer        = "ms"
+	TypeHistogram    = "h"
+	TypeDistribution = "d"
+)
+
+var ErrUnsupportedType = errors.New("unsupported metric type")
+
+type Sample struct {
+	Name   string
+	Type   string
+	Value  float64
+	Rate   float64
+	Labels map[string]string
+	// Relative is set for gauges sent as "+N" or "-N", which adjust the current value.
+	Relative bool
+}
+
+func ParsePacket(packet []byte) ([]Sample, []error) {
+	var samples []Sample
+	var errs []error
+	for _, line := range strings.Split(string(packet), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		sample, err := ParseLine(line)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%q: %w", line, err))
+			continue
+		}
+		samples = append(samples, sample)
+	}
+	return samples, errs
+}
+
+// ParseLine parses "name:value|type[|@rate][|#tag:value,...]".
+func ParseLine(line string) (Sample, error) {
+	name, rest, found := strings.Cut(line, ":")
+	if !found || name == "" {
+		return Sample{}, errors.New("missing metric name")
+	}
+	if strings.ContainsAny(name, "{}") {
+		return Sample{}, errors.New("invalid metric name")
+	}
+
+	fields := strings.Split(rest, "|")
+	if len(fields) < 2 {
+		return Sample{}, errors.New("missing metric type")
+	}
+
+	sample := Sample{Name: name, Type: fields[1], Rate: 1}
+	switch sample.Type {
+	case TypeCounter, TypeGauge, TypeTimer, TypeHistogram, TypeDistribution:
+	default:
+		return Sample{}, fmt.Errorf("%w %q", ErrUnsupportedType, sample.Type)
+	}
+
+	rawValue := fields[0]
+	if sample.Type == TypeGauge && (strings.HasPrefix(rawValue, "+") || strings.HasPrefix(rawValue, "-")) {
+		sample.Relative = true
+	}
+	value, err := strconv.ParseFloat(rawValue, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return Sample{}, fmt.Errorf("invalid value %q", rawValue)
+	}
+	sample.Value = value
+
+	for _, field := range fields[2:] {
+		switch {
+		case strings.HasPrefix(field, "@"):
+			rate, err := strconv.ParseFloat(field[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return Sample{}, fmt.Errorf("invalid sample rate %q", field)
+			}
+			sample.Rate = rate
+		case strings.HasPrefix(field, "#"):
+			sample.Labels, err = parseTags(field[1:])
+			if err != nil {
+				return Sample{}, err
+			}
+		}
+	}
+	return sample, nil
+}
+
+// DogStatsD tags without a value become labels with the value "true".
+func parseTags(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, tag := range strings.Split(s, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		key, value, found := strings.Cut(tag, ":")
+		if !found {
+			value = "true"
+		}
+		if !models.ValidLabelName(key) {
+			return nil, fmt.Errorf("invalid tag name %q", key)
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
@@ -0,0 +1,149 @@
+package statsd
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/alisaviation/monitoring/internal/logger"
+	"github.com/alisaviation/monitoring/internal/models"
+	"github.com/alisaviation/monitoring/internal/storage"
+)
+
+const maxPacketSize = 65535
+
+var DefaultTimerBuckets = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+type Server struct {
+	TrustedSubnet *net.IPNet
+
+	storage       storage.Storage
+	flushInterval time.Duration
+	buckets       []float64
+	timers        map[string]*models.HistogramValue
+	mu            sync.Mutex
+}
+
+func NewServer(storage storage.Storage, flushInterval time.Duration, buckets []float64) *Server {
+	if len(buckets) == 0 {
+		buckets = DefaultTimerBuckets
+	}
+	return &Server{
+		storage:       storage,
+		flushInterval: flushInterval,
+		buckets:       buckets,
+		timers:        make(map[string]*models.HistogramValue),
+	}
+}
+
+// Serve reads packets from conn until ctx is cancelled, then flushes the pending timers.
+func (s *Server) Serve(ctx context.Context, conn net.PacketConn) error {
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(s.flushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.Flush(ctx)
+			}
+		}
+	}()
+	defer func() {
+		wg.Wait()
+		s.Flush(context.Background())
+	}()
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		if !s.allowed(addr) {
+			logger.Log.Debug("Dropping StatsD packet from untrusted address", zap.String("addr", addr.String()))
+			continue
+		}
+		s.HandlePacket(ctx, buf[:n])
+	}
+}
+
+func (s *Server) allowed(addr net.Addr) bool {
+	if s.TrustedSubnet == nil {
+		return true
+	}
+	udpAddr, ok := addr.(*net.UDPAddr)
+	return ok && s.TrustedSubnet.Contains(udpAddr.IP)
+}
+
+func (s *Server) HandlePacket(ctx context.Context, packet []byte) {
+	samples, errs := ParsePacket(packet)
+	for _, err := range errs {
+		logger.Log.Debug("Invalid StatsD line", zap.Error(err))
+	}
+	for _, sample := range samples {
+		if err := s.apply(ctx, sample); err != nil {
+			logger.Log.Error("Failed to store StatsD sample", zap.String("name", sample.Name), zap.Error(err))
+		}
+	}
+}
+
+func (s *Server) apply(ctx context.Context, sample Sample) error {
+	key := models.SeriesKey(sample.Name, sample.Labels)
+	switch sample.Type {
+	case TypeCounter:
+		return s.storage.AddCounter(ctx, key, int64(math.Round(sample.Value/sample.Rate)))
+	case TypeGauge:
+		value := sample.Value
+		if sample.Relative {
+			if current, err := s.storage.GetGauge(ctx, key); err == nil {
+				value += *current
+			}
+		}
+		return s.storage.SetGauge(ctx, key, value)
+	default:
+		s.observe(key, sample.Value, sample.Rate)
+		return nil
+	}
+}
+
+func (s *Server) observe(key string, value, rate float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	histogram, exists := s.timers[key]
+	if !exists {
+		histogram = models.NewHistogram(s.buckets)
+		s.timers[key] = histogram
+	}
+	histogram.ObserveN(value, uint64(math.Round(1/rate)))
+}
+
+func (s *Server) Flush(ctx context.Context) {
+	s.mu.Lock()
+	timers := s.timers
+	s.timers = make(map[string]*models.HistogramValue)
+	s.mu.Unlock()
+
+	for key, histogram := range timers {
+		if err := s.storage.AddHistogram(ctx, key, *histogram); err != nil {
+			logger.Log.Error("Failed to flush StatsD timer", zap.String("name", key), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package statsd
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/alisaviation/monitoring/internal/models"
+	"github.com/alisaviation/monitoring/internal/storage"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    Sample
+		wantErr bool
+	}{
+		{"Counter", "requests:1|c", Sample{Name: "requests", Type: TypeCounter, Value: 1, Rate: 1}, false},
+		{"Sampled Counter", "requests:2|c|@0.5", Sample{Name: "requests", Type: TypeCounter, Value: 2, Rate: 0.5}, false},
+		{"Gauge", "temperature:3.2|g", Sample{Name: "temperature", Type: TypeGauge, Value: 3.2, Rate: 1}, false},
+		{"Relative Gauge", "queue:-4|g", Sample{Name: "queue", Type: TypeGauge, Value: -4, Rate: 1, Relative: true}, false},
+		{"Timer With Tags", "latency:120|ms|#env:prod,canary", Sample{
+			Name: "latency", Type: TypeTimer, Value: 120, Rate: 1,
+			Labels: map[string]string{"env": "prod", "canary": "true"},
+		}, false},
+		{"Missing Type", "requests:1", Sample{}, true},
+		{"Set Unsupported", "users:42|s", Sample{}, true},
+		{"Invalid Value", "requests:abc|c", Sample{}, true},
+		{"NaN Value", "temperature:NaN|g", Sample{}, true},
+		{"Inf Value", "latency:+Inf|ms", Sample{}, true},
+		{"Invalid Rate", "requests:1|c|@2", Sample{}, true},
+		{"Invalid Name", "req{uests}:1|c", Sample{}, true},
+		{"Invalid Tag Name", `requests:1|c|#"env":prod`, Sample{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLine(tt.line)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestServer(t *testing.T) {
+	ctx := context.Background()
+	memStorage := storage.NewMemStorage("")
+	require.NoError(t, memStorage.SetGauge(ctx, "queue", 10))
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := NewServer(memStorage, time.Hour, []float64{100, 200})
+	serveCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() {
+		done <- server.Serve(serveCtx, conn)
+	}()
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer client.Close()
+
+	_, err = client.Write([]byte("requests:1|c|#env:prod\nrequests:2|c|@0.5|#env:prod\nqueue:-3|g\nbogus\n"))
+	require.NoError(t, err)
+	_, err = client.Write([]byte("latency:50|ms\nlatency:150|ms|@0.5\nlatency:500|ms"))
+	require.NoError(t, err)
+
+	requests := models.SeriesKey("requests", map[string]string{"env": "prod"})
+	require.Eventually(t, func() bool {
+		counter, err := memStorage.GetCounter(ctx, requests)
+		return err == nil && *counter == 5
+	}, time.Second, 10*time.Millisecond)
+
+	gauge, err := memStorage.GetGauge(ctx, "queue")
+	require.NoError(t, err)
+	require.Equal(t, 7.0, *gauge)
+
+	require.Eventually(t, func() bool {
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		h, exists := server.timers["latency"]
+		return exists && h.Count == 4
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+
+	histogram, err := memStorage.GetHistogram(ctx, "latency")
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), histogram.Count)
+	require.Equal(t, []models.Bucket{{UpperBound: 100, Count: 1}, {UpperBound: 200, Count: 3}}, histogram.Buckets)
+	require.Equal(t, 850.0, histogram.Sum)
+}
+
+func TestServerTrustedSubnet(t *testing.T) {
+	_, subnet, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+
+	server := NewServer(storage.NewMemStorage(""), time.Hour, nil)
+	server.TrustedSubnet = subnet
+	require.True(t, server.allowed(&net.UDPAddr{IP: net.ParseIP("10.1.2.3")}))
+	require.False(t, server.allowed(&net.UDPAddr{IP: net.ParseIP("127.0.0.1")}))
+}
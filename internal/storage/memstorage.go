@@ -3,40 +3,199 @@ package storage
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
 	"os"
+	"slices"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/alisaviation/monitoring/internal/models"
 )
 
 type MemStorage struct {
-	gauges   map[string]float64
-	counters map[string]int64
-	mu       sync.Mutex
-	filePath string
+	gauges      map[string]float64
+	counters    map[string]int64
+	histograms  map[string]models.HistogramValue
+	summaries   map[string]models.SummaryValue
+	history     map[string]*ringBuffer
+	updated     map[string]time.Time
+	historySize int
+	mu          sync.Mutex
+	filePath    string
+	wal         *wal
+	retention   int
+	loadedFrom  string
 }
 
 func NewMemStorage(filePath string) *MemStorage {
 	return &MemStorage{
-		gauges:   make(map[string]float64),
-		counters: make(map[string]int64),
-		filePath: filePath,
+		gauges:      make(map[string]float64),
+		counters:    make(map[string]int64),
+		histograms:  make(map[string]models.HistogramValue),
+		summaries:   make(map[string]models.SummaryValue),
+		history:     make(map[string]*ringBuffer),
+		updated:     make(map[string]time.Time),
+		historySize: DefaultHistorySize,
+		filePath:    filePath,
+		retention:   DefaultSnapshotRetention,
 	}
 }
 
+func (m *MemStorage) SetSnapshotRetention(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.retention = n
+}
+
+func (m *MemStorage) SetHistorySize(size int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.historySize = size
+}
+
+func (m *MemStorage) EnableWAL(path string) error {
+	w, err := openWAL(path)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.wal = w
+	return nil
+}
+
 func (m *MemStorage) SetGauge(ctx context.Context, name string, value float64) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	now := time.Now()
+	if m.wal != nil {
+		if err := m.wal.append(walEntry{Type: models.Gauge, Name: name, Value: value, TS: now.UnixNano()}); err != nil {
+			return err
+		}
+	}
 	m.gauges[name] = value
+	m.record(models.Gauge, name, value, now)
 	return nil
 }
 
 func (m *MemStorage) AddCounter(ctx context.Context, name string, value int64) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	now := time.Now()
+	if m.wal != nil {
+		if err := m.wal.append(walEntry{Type: models.Counter, Name: name, Delta: value, TS: now.UnixNano()}); err != nil {
+			return err
+		}
+	}
 	m.counters[name] += value
+	m.record(models.Counter, name, float64(m.counters[name]), now)
 	return nil
 }
 
+func (m *MemStorage) record(mType, name string, value float64, now time.Time) {
+	key := mType + ":" + name
+	buffer, exists := m.history[key]
+	if !exists {
+		buffer = newRingBuffer(m.historySize)
+		m.history[key] = buffer
+	}
+	buffer.add(models.Sample{Timestamp: now, Value: value})
+	m.updated[key] = now
+}
+
+func (m *MemStorage) AddHistogram(ctx context.Context, name string, value models.HistogramValue) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if m.wal != nil {
+		if err := m.wal.append(walEntry{Type: models.Histogram, Name: name, Histogram: &value, TS: now.UnixNano()}); err != nil {
+			return err
+		}
+	}
+	m.mergeHistogram(name, value)
+	m.record(models.Histogram, name, float64(m.histograms[name].Count), now)
+	return nil
+}
+
+func (m *MemStorage) mergeHistogram(name string, value models.HistogramValue) {
+	current, exists := m.histograms[name]
+	if !exists {
+		m.histograms[name] = value.Clone()
+		return
+	}
+	current.Merge(value)
+	m.histograms[name] = current
+}
+
+func (m *MemStorage) GetHistogram(ctx context.Context, name string) (*models.HistogramValue, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, exists := m.histograms[name]
+	if !exists {
+		return nil, sql.ErrNoRows
+	}
+	value = value.Clone()
+	return &value, nil
+}
+
+func (m *MemStorage) Histograms(ctx context.Context) (map[string]models.HistogramValue, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	histograms := make(map[string]models.HistogramValue, len(m.histograms))
+	for name, value := range m.histograms {
+		histograms[name] = value.Clone()
+	}
+	return histograms, nil
+}
+
+func (m *MemStorage) SetSummary(ctx context.Context, name string, value models.SummaryValue) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if m.wal != nil {
+		if err := m.wal.append(walEntry{Type: models.Summary, Name: name, Summary: &value, TS: now.UnixNano()}); err != nil {
+			return err
+		}
+	}
+	m.summaries[name] = value.Clone()
+	m.record(models.Summary, name, float64(value.Count), now)
+	return nil
+}
+
+func (m *MemStorage) GetSummary(ctx context.Context, name string) (*models.SummaryValue, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, exists := m.summaries[name]
+	if !exists {
+		return nil, sql.ErrNoRows
+	}
+	value = value.Clone()
+	return &value, nil
+}
+
+func (m *MemStorage) Summaries(ctx context.Context) (map[string]models.SummaryValue, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	summaries := make(map[string]models.SummaryValue, len(m.summaries))
+	for name, value := range m.summaries {
+		summaries[name] = value.Clone()
+	}
+	return summaries, nil
+}
+
+func (m *MemStorage) Samples(ctx context.Context, mType, name string, from, to time.Time) ([]models.Sample, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	buffer, exists := m.history[mType+":"+name]
+	if !exists {
+		return nil, sql.ErrNoRows
+	}
+	return buffer.rangeSamples(from, to), nil
+}
+
 func (m *MemStorage) GetGauge(ctx context.Context, name string) (*float64, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -60,68 +219,314 @@ func (m *MemStorage) GetCounter(ctx context.Context, name string) (*int64, error
 func (m *MemStorage) Gauges(ctx context.Context) (map[string]float64, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	return m.gauges, nil
+	gauges := make(map[string]float64, len(m.gauges))
+	for name, value := range m.gauges {
+		gauges[name] = value
+	}
+	return gauges, nil
 }
 
 func (m *MemStorage) Counters(ctx context.Context) (map[string]int64, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	return m.counters, nil
+	counters := make(map[string]int64, len(m.counters))
+	for name, value := range m.counters {
+		counters[name] = value
+	}
+	return counters, nil
 }
 
-func (m *MemStorage) Save() error {
+func (m *MemStorage) DeleteGauge(ctx context.Context, name string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	if _, exists := m.gauges[name]; !exists {
+		return sql.ErrNoRows
+	}
+	return m.deleteSeries(models.Gauge, name)
+}
 
-	data := struct {
-		Gauges   map[string]float64 `json:"gauges"`
-		Counters map[string]int64   `json:"counters"`
-	}{
-		Gauges:   m.gauges,
-		Counters: m.counters,
+func (m *MemStorage) DeleteCounter(ctx context.Context, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.counters[name]; !exists {
+		return sql.ErrNoRows
 	}
-	jsonData, err := json.MarshalIndent(data, "", "    ")
-	if err != nil {
-		return err
+	return m.deleteSeries(models.Counter, name)
+}
+
+func (m *MemStorage) DeleteHistogram(ctx context.Context, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.histograms[name]; !exists {
+		return sql.ErrNoRows
 	}
-	jsonData = append(jsonData, '\n')
+	return m.deleteSeries(models.Histogram, name)
+}
 
-	file, err := os.Create(m.filePath)
-	if err != nil {
-		return err
+func (m *MemStorage) DeleteSummary(ctx context.Context, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.summaries[name]; !exists {
+		return sql.ErrNoRows
 	}
-	defer file.Close()
+	return m.deleteSeries(models.Summary, name)
+}
 
-	_, err = file.Write(jsonData)
-	return err
+func (m *MemStorage) ResetCounter(ctx context.Context, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.counters[name]; !exists {
+		return sql.ErrNoRows
+	}
+	now := time.Now()
+	if m.wal != nil {
+		if err := m.wal.append(walEntry{Op: walOpReset, Type: models.Counter, Name: name, TS: now.UnixNano()}); err != nil {
+			return err
+		}
+	}
+	m.counters[name] = 0
+	m.record(models.Counter, name, 0, now)
+	return nil
+}
+
+func (m *MemStorage) DeleteMetrics(ctx context.Context, filter DeleteFilter) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deleted := 0
+	for mType, names := range m.seriesNames() {
+		for _, name := range names {
+			if !filter.Match(mType, name) {
+				continue
+			}
+			if err := m.deleteSeries(mType, name); err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (m *MemStorage) seriesNames() map[string][]string {
+	return map[string][]string{
+		models.Gauge:     slices.Collect(maps.Keys(m.gauges)),
+		models.Counter:   slices.Collect(maps.Keys(m.counters)),
+		models.Histogram: slices.Collect(maps.Keys(m.histograms)),
+		models.Summary:   slices.Collect(maps.Keys(m.summaries)),
+	}
+}
+
+func (m *MemStorage) deleteSeries(mType, name string) error {
+	if m.wal != nil {
+		if err := m.wal.append(walEntry{Op: walOpDelete, Type: mType, Name: name}); err != nil {
+			return err
+		}
+	}
+	m.removeSeries(mType, name)
+	return nil
+}
+
+func (m *MemStorage) removeSeries(mType, name string) {
+	switch mType {
+	case models.Gauge:
+		delete(m.gauges, name)
+	case models.Counter:
+		delete(m.counters, name)
+	case models.Histogram:
+		delete(m.histograms, name)
+	case models.Summary:
+		delete(m.summaries, name)
+	}
+	delete(m.history, mType+":"+name)
+	delete(m.updated, mType+":"+name)
+}
+
+func (m *MemStorage) LastUpdated(ctx context.Context, mType, name string) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	updated, exists := m.updated[mType+":"+name]
+	if !exists {
+		return time.Time{}, sql.ErrNoRows
+	}
+	return updated, nil
+}
+
+func (m *MemStorage) UpdateTimes(ctx context.Context, mType string) (map[string]time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	prefix := mType + ":"
+	times := make(map[string]time.Time)
+	for key, updated := range m.updated {
+		if name, ok := strings.CutPrefix(key, prefix); ok {
+			times[name] = updated
+		}
+	}
+	return times, nil
+}
+
+func (m *MemStorage) ExpireSeries(ctx context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expired := 0
+	for key, updated := range m.updated {
+		if !updated.Before(before) {
+			continue
+		}
+		mType, name, _ := strings.Cut(key, ":")
+		if err := m.deleteSeries(mType, name); err != nil {
+			return expired, err
+		}
+		expired++
+	}
+	return expired, nil
+}
+
+func (m *MemStorage) PruneSamples(ctx context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pruned := 0
+	for key, buffer := range m.history {
+		pruned += buffer.dropBefore(before)
+		if buffer.size == 0 {
+			delete(m.history, key)
+		}
+	}
+	return pruned, nil
+}
+
+func (m *MemStorage) Save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := writeSnapshot(m.filePath, m.retention, snapshot{
+		Gauges:     m.gauges,
+		Counters:   m.counters,
+		Histograms: m.histograms,
+		Summaries:  m.summaries,
+		Updated:    m.updated,
+	}); err != nil {
+		return err
+	}
+	if m.wal == nil {
+		return nil
+	}
+	return m.wal.truncate(0)
 }
 
 func (m *MemStorage) Load() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	file, err := os.Open(m.filePath)
-	if err != nil {
+	err := m.loadSnapshot()
+	if err != nil && (m.wal == nil || !errors.Is(err, os.ErrNotExist)) {
 		return err
 	}
-	defer file.Close()
+	defer m.fillUpdated()
+	if m.wal == nil {
+		return nil
+	}
+
+	applied, size, walErr := replayWAL(m.wal.path, m.applyWALEntry)
+	if walErr != nil {
+		return fmt.Errorf("replay wal: %w", walErr)
+	}
+	if err := m.wal.truncate(size); err != nil {
+		return err
+	}
+	if err != nil && applied == 0 {
+		return err
+	}
+	return nil
+}
+
+func (m *MemStorage) applyWALEntry(entry walEntry) {
+	switch {
+	case entry.Op == walOpDelete:
+		m.removeSeries(entry.Type, entry.Name)
+		return
+	case entry.Op == walOpReset && entry.Type == models.Counter:
+		m.counters[entry.Name] = 0
+	case entry.Op != "":
+		return
+	case entry.Type == models.Gauge:
+		m.gauges[entry.Name] = entry.Value
+	case entry.Type == models.Counter:
+		m.counters[entry.Name] += entry.Delta
+	case entry.Type == models.Histogram && entry.Histogram != nil:
+		m.mergeHistogram(entry.Name, *entry.Histogram)
+	case entry.Type == models.Summary && entry.Summary != nil:
+		m.summaries[entry.Name] = *entry.Summary
+	default:
+		return
+	}
+	if entry.TS > 0 {
+		m.updated[entry.Type+":"+entry.Name] = time.Unix(0, entry.TS)
+	}
+}
 
-	data := struct {
-		Gauges   map[string]float64 `json:"gauges"`
-		Counters map[string]int64   `json:"counters"`
-	}{}
+// Series restored without a timestamp count as updated at load time so they are not expired right away.
+func (m *MemStorage) fillUpdated() {
+	now := time.Now()
+	for mType, names := range m.seriesNames() {
+		for _, name := range names {
+			if _, exists := m.updated[mType+":"+name]; !exists {
+				m.updated[mType+":"+name] = now
+			}
+		}
+	}
+}
 
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&data); err != nil {
+func (m *MemStorage) loadSnapshot() error {
+	data, path, err := readNewestSnapshot(m.filePath, m.retention)
+	if err != nil {
 		return err
 	}
+	m.loadedFrom = path
 
 	m.gauges = data.Gauges
 	m.counters = data.Counters
+	m.histograms = data.Histograms
+	m.summaries = data.Summaries
+	m.updated = data.Updated
+	if m.histograms == nil {
+		m.histograms = make(map[string]models.HistogramValue)
+	}
+	if m.summaries == nil {
+		m.summaries = make(map[string]models.SummaryValue)
+	}
+	if m.updated == nil {
+		m.updated = make(map[string]time.Time)
+	}
+	if m.gauges == nil {
+		m.gauges = make(map[string]float64)
+	}
+	if m.counters == nil {
+		m.counters = make(map[string]int64)
+	}
 
 	return nil
 }
 
+func (m *MemStorage) LoadedFrom() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.loadedFrom
+}
+
+func (m *MemStorage) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.wal == nil {
+		return nil
+	}
+	err := m.wal.close()
+	m.wal = nil
+	return err
+}
+
 func (m *MemStorage) IsUniqueViolationError(err error) bool {
 	return false
 }
@@ -0,0 +1,367 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/alisaviation/monitoring/internal/models"
+)
+
+func TestMemStorageSamples(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemStorage("")
+	m.SetHistorySize(3)
+
+	from := time.Now().Add(-time.Minute)
+	for i := 1; i <= 5; i++ {
+		require.NoError(t, m.SetGauge(ctx, "HeapAlloc", float64(i)))
+		require.NoError(t, m.AddCounter(ctx, "PollCount", 1))
+	}
+	to := time.Now().Add(time.Minute)
+
+	gauges, err := m.Samples(ctx, models.Gauge, "HeapAlloc", from, to)
+	require.NoError(t, err)
+	require.Len(t, gauges, 3)
+	require.Equal(t, []float64{3, 4, 5}, sampleValues(gauges))
+
+	counters, err := m.Samples(ctx, models.Counter, "PollCount", from, to)
+	require.NoError(t, err)
+	require.Equal(t, []float64{3, 4, 5}, sampleValues(counters))
+
+	empty, err := m.Samples(ctx, models.Gauge, "HeapAlloc", to, to.Add(time.Minute))
+	require.NoError(t, err)
+	require.Empty(t, empty)
+
+	_, err = m.Samples(ctx, models.Gauge, "Unknown", from, to)
+	require.Error(t, err)
+}
+
+func TestMemStoragePruneSamples(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemStorage("")
+	m.SetHistorySize(3)
+
+	require.NoError(t, m.SetGauge(ctx, "HeapAlloc", 1))
+	// History grows with the series instead of being allocated up front.
+	require.Len(t, m.history[models.Gauge+":HeapAlloc"].samples, 1)
+	cutoff := time.Now()
+	for i := 2; i <= 4; i++ {
+		require.NoError(t, m.SetGauge(ctx, "HeapAlloc", float64(i)))
+	}
+
+	pruned, err := m.PruneSamples(ctx, cutoff)
+	require.NoError(t, err)
+	require.Zero(t, pruned)
+
+	// A wrapped buffer keeps the newest samples in order after pruning.
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	buffer := newRingBuffer(3)
+	for i := 0; i < 5; i++ {
+		buffer.add(models.Sample{Timestamp: start.Add(time.Duration(i) * time.Second), Value: float64(i)})
+	}
+	require.Equal(t, 1, buffer.dropBefore(start.Add(3*time.Second)))
+	require.Equal(t, []float64{3, 4}, sampleValues(buffer.rangeSamples(start, start.Add(time.Minute))))
+	buffer.add(models.Sample{Timestamp: start.Add(5 * time.Second), Value: 5})
+	buffer.add(models.Sample{Timestamp: start.Add(6 * time.Second), Value: 6})
+	require.Equal(t, []float64{4, 5, 6}, sampleValues(buffer.rangeSamples(start, start.Add(time.Minute))))
+
+	pruned, err = m.PruneSamples(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, 3, pruned)
+	require.Empty(t, m.history)
+}
+
+func TestMemStorageWAL(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	snapshotPath := filepath.Join(dir, "metrics.json")
+	walPath := filepath.Join(dir, "metrics.wal")
+
+	m := NewMemStorage(snapshotPath)
+	require.NoError(t, m.EnableWAL(walPath))
+	require.NoError(t, m.SetGauge(ctx, "HeapAlloc", 1.5))
+	require.NoError(t, m.AddCounter(ctx, "PollCount", 2))
+	require.NoError(t, m.Save())
+
+	info, err := os.Stat(walPath)
+	require.NoError(t, err)
+	require.Zero(t, info.Size())
+
+	require.NoError(t, m.SetGauge(ctx, "HeapAlloc", 2.5))
+	require.NoError(t, m.AddCounter(ctx, "PollCount", 3))
+	require.NoError(t, m.AddCounter(ctx, "PollCount", 4))
+	require.NoError(t, m.Close())
+
+	// Simulate a crash in the middle of a write.
+	file, err := os.OpenFile(walPath, os.O_WRONLY|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"type":"counter","name":"PollCo`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	restored := NewMemStorage(snapshotPath)
+	require.NoError(t, restored.EnableWAL(walPath))
+	require.NoError(t, restored.Load())
+
+	gauge, err := restored.GetGauge(ctx, "HeapAlloc")
+	require.NoError(t, err)
+	require.Equal(t, 2.5, *gauge)
+
+	counter, err := restored.GetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	require.Equal(t, int64(9), *counter)
+
+	// Writes after recovering from a torn tail must survive the next restart.
+	require.NoError(t, restored.AddCounter(ctx, "PollCount", 1))
+	require.NoError(t, restored.Close())
+
+	reloaded := NewMemStorage(snapshotPath)
+	require.NoError(t, reloaded.EnableWAL(walPath))
+	require.NoError(t, reloaded.Load())
+	counter, err = reloaded.GetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	require.Equal(t, int64(10), *counter)
+}
+
+func TestMemStorageWALWithoutSnapshot(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	snapshotPath := filepath.Join(dir, "metrics.json")
+	walPath := filepath.Join(dir, "metrics.wal")
+
+	empty := NewMemStorage(snapshotPath)
+	require.NoError(t, empty.EnableWAL(walPath))
+	require.Error(t, empty.Load())
+	require.NoError(t, empty.Close())
+
+	m := NewMemStorage(snapshotPath)
+	require.NoError(t, m.EnableWAL(walPath))
+	require.NoError(t, m.AddCounter(ctx, "PollCount", 5))
+	require.NoError(t, m.Close())
+
+	restored := NewMemStorage(snapshotPath)
+	require.NoError(t, restored.EnableWAL(walPath))
+	require.NoError(t, restored.Load())
+
+	counter, err := restored.GetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	require.Equal(t, int64(5), *counter)
+}
+
+func TestMemStorageDeleteWAL(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	snapshotPath := filepath.Join(dir, "metrics.json")
+	walPath := filepath.Join(dir, "metrics.wal")
+
+	m := NewMemStorage(snapshotPath)
+	require.NoError(t, m.EnableWAL(walPath))
+	require.NoError(t, m.SetGauge(ctx, "HeapAlloc", 1))
+	require.NoError(t, m.SetGauge(ctx, models.SeriesKey("DiskFree", map[string]string{"path": "/"}), 2))
+	require.NoError(t, m.AddCounter(ctx, "PollCount", 3))
+	require.NoError(t, m.AddCounter(ctx, "Requests", 4))
+	require.NoError(t, m.AddHistogram(ctx, "Latency", *models.NewHistogram([]float64{1})))
+	require.NoError(t, m.SetSummary(ctx, "RPC", models.SummaryValue{Sum: 1, Count: 1}))
+
+	require.NoError(t, m.DeleteGauge(ctx, "HeapAlloc"))
+	require.Error(t, m.DeleteGauge(ctx, "HeapAlloc"))
+	require.NoError(t, m.ResetCounter(ctx, "PollCount"))
+	deleted, err := m.DeleteMetrics(ctx, DeleteFilter{Labels: map[string]string{"path": "/"}})
+	require.NoError(t, err)
+	require.Equal(t, 1, deleted)
+	require.NoError(t, m.DeleteCounter(ctx, "Requests"))
+	require.NoError(t, m.DeleteHistogram(ctx, "Latency"))
+	require.Error(t, m.DeleteHistogram(ctx, "Latency"))
+	require.NoError(t, m.DeleteSummary(ctx, "RPC"))
+	require.NoError(t, m.Close())
+
+	restored := NewMemStorage(snapshotPath)
+	require.NoError(t, restored.EnableWAL(walPath))
+	require.NoError(t, restored.Load())
+
+	gauges, err := restored.Gauges(ctx)
+	require.NoError(t, err)
+	require.Empty(t, gauges)
+	counters, err := restored.Counters(ctx)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int64{"PollCount": 0}, counters)
+	histograms, err := restored.Histograms(ctx)
+	require.NoError(t, err)
+	require.Empty(t, histograms)
+	summaries, err := restored.Summaries(ctx)
+	require.NoError(t, err)
+	require.Empty(t, summaries)
+}
+
+func TestMemStorageExpireSeries(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.json")
+
+	m := NewMemStorage(path)
+	require.NoError(t, m.SetGauge(ctx, "HeapAlloc", 1))
+	require.NoError(t, m.AddCounter(ctx, "PollCount", 1))
+	require.NoError(t, m.SetGauge(ctx, "Decommissioned", 1))
+
+	old := time.Now().Add(-time.Hour)
+	m.updated[models.Gauge+":Decommissioned"] = old
+	require.NoError(t, m.Save())
+
+	restored := NewMemStorage(path)
+	require.NoError(t, restored.Load())
+	updated, err := restored.LastUpdated(ctx, models.Gauge, "Decommissioned")
+	require.NoError(t, err)
+	require.True(t, updated.Equal(old))
+
+	times, err := restored.UpdateTimes(ctx, models.Counter)
+	require.NoError(t, err)
+	require.Len(t, times, 1)
+	require.Contains(t, times, "PollCount")
+
+	expired, err := restored.ExpireSeries(ctx, time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, 1, expired)
+
+	_, err = restored.GetGauge(ctx, "Decommissioned")
+	require.Error(t, err)
+	_, err = restored.LastUpdated(ctx, models.Gauge, "Decommissioned")
+	require.Error(t, err)
+	_, err = restored.GetGauge(ctx, "HeapAlloc")
+	require.NoError(t, err)
+}
+
+func TestMemStorageDistributions(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	snapshotPath := filepath.Join(dir, "metrics.json")
+	walPath := filepath.Join(dir, "metrics.wal")
+
+	observe := func(bounds []float64, values ...float64) models.HistogramValue {
+		h := models.NewHistogram(bounds)
+		for _, v := range values {
+			h.Observe(v)
+		}
+		return *h
+	}
+
+	m := NewMemStorage(snapshotPath)
+	require.NoError(t, m.EnableWAL(walPath))
+	require.NoError(t, m.AddHistogram(ctx, "latency", observe([]float64{0.1, 1}, 0.05, 0.5)))
+	require.NoError(t, m.Save())
+	require.NoError(t, m.AddHistogram(ctx, "latency", observe([]float64{0.1, 1}, 0.5, 5)))
+	require.NoError(t, m.SetSummary(ctx, "rpc", models.SummaryValue{
+		Quantiles: []models.Quantile{{Quantile: 0.5, Value: 0.2}, {Quantile: 0.99, Value: 0.9}},
+		Sum:       10,
+		Count:     20,
+	}))
+	require.NoError(t, m.Close())
+
+	restored := NewMemStorage(snapshotPath)
+	require.NoError(t, restored.EnableWAL(walPath))
+	require.NoError(t, restored.Load())
+
+	histogram, err := restored.GetHistogram(ctx, "latency")
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), histogram.Count)
+	require.Equal(t, []models.Bucket{{UpperBound: 0.1, Count: 1}, {UpperBound: 1, Count: 3}}, histogram.Buckets)
+
+	summary, err := restored.GetSummary(ctx, "rpc")
+	require.NoError(t, err)
+	require.Equal(t, uint64(20), summary.Count)
+	require.Len(t, summary.Quantiles, 2)
+
+	// A different bucket layout replaces the stored histogram.
+	require.NoError(t, restored.AddHistogram(ctx, "latency", observe([]float64{1}, 0.5)))
+	histogram, err = restored.GetHistogram(ctx, "latency")
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), histogram.Count)
+
+	deleted, err := restored.DeleteMetrics(ctx, DeleteFilter{Type: models.Summary, Prefix: "rpc"})
+	require.NoError(t, err)
+	require.Equal(t, 1, deleted)
+	summaries, err := restored.Summaries(ctx)
+	require.NoError(t, err)
+	require.Empty(t, summaries)
+}
+
+func TestMemStorageSnapshotRotation(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.json")
+
+	m := NewMemStorage(path)
+	m.SetSnapshotRetention(2)
+	for i := 1; i <= 4; i++ {
+		require.NoError(t, m.SetGauge(ctx, "HeapAlloc", float64(i)))
+		require.NoError(t, m.Save())
+	}
+
+	for n, expected := range map[string]float64{path: 4, path + ".1": 3, path + ".2": 2} {
+		data, err := readSnapshot(n)
+		require.NoError(t, err)
+		require.Equal(t, expected, data.Gauges["HeapAlloc"])
+	}
+	_, err := os.Stat(path + ".3")
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	matches, err := filepath.Glob(path + ".tmp-*")
+	require.NoError(t, err)
+	require.Empty(t, matches)
+
+	// The live snapshot stays in place while a new one is written.
+	require.NoError(t, rotateSnapshots(path, 2))
+	data, err := readSnapshot(path)
+	require.NoError(t, err)
+	require.Equal(t, 4.0, data.Gauges["HeapAlloc"])
+}
+
+func TestMemStorageLoadFallback(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.json")
+
+	m := NewMemStorage(path)
+	require.NoError(t, m.SetGauge(ctx, "HeapAlloc", 1))
+	require.NoError(t, m.Save())
+	require.NoError(t, m.SetGauge(ctx, "HeapAlloc", 2))
+	require.NoError(t, m.Save())
+
+	// Truncated write of the newest snapshot.
+	require.NoError(t, os.WriteFile(path, []byte(`{"gauges": {"HeapAl`), 0o644))
+
+	restored := NewMemStorage(path)
+	require.NoError(t, restored.Load())
+	require.Equal(t, path+".1", restored.LoadedFrom())
+	gauge, err := restored.GetGauge(ctx, "HeapAlloc")
+	require.NoError(t, err)
+	require.Equal(t, 1.0, *gauge)
+
+	// Well-formed JSON with a value changed after the checksum was computed.
+	require.NoError(t, os.WriteFile(path+".1",
+		[]byte(`{"gauges":{"HeapAlloc":5},"counters":{},"checksum":"00"}`), 0o644))
+	_, err = readSnapshot(path + ".1")
+	require.ErrorIs(t, err, ErrSnapshotChecksum)
+	require.Error(t, NewMemStorage(path).Load())
+}
+
+func TestMemStorageLoadLegacySnapshot(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"gauges":{"HeapAlloc":1.5},"counters":{"PollCount":3}}`), 0o644))
+
+	m := NewMemStorage(path)
+	require.NoError(t, m.Load())
+	counter, err := m.GetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	require.Equal(t, int64(3), *counter)
+}
+
+func sampleValues(samples []models.Sample) []float64 {
+	values := make([]float64, 0, len(samples))
+	for _, s := range samples {
+		values = append(values, s.Value)
+	}
+	return values
+}
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS samples_series_ts_idx;
+DROP TABLE IF EXISTS samples;
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS samples (
+    name TEXT NOT NULL,
+    type TEXT NOT NULL,
+    value DOUBLE PRECISION NOT NULL,
+    ts TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS samples_series_ts_idx ON samples (type, name, ts);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS samples_ts_idx;
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS samples_ts_idx ON samples (ts);
@@ -0,0 +1 @@
+ALTER TABLE counters DROP COLUMN IF EXISTS source_value;
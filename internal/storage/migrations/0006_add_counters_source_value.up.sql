@@ -0,0 +1 @@
+ALTER TABLE counters ADD COLUMN IF NOT EXISTS source_value BIGINT;
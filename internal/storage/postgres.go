@@ -3,11 +3,80 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgerrcode"
 	"github.com/lib/pq"
+
+	"github.com/alisaviation/monitoring/internal/models"
+)
+
+const (
+	UpsertGaugeQuery = `
+		WITH upserted AS (
+			INSERT INTO gauges (name, value)
+			VALUES ($1, $2)
+			ON CONFLICT (name) DO UPDATE SET value = EXCLUDED.value, updated_at = now()
+			RETURNING name, value
+		)
+		INSERT INTO samples (name, type, value)
+		SELECT name, 'gauge', value FROM upserted
+	`
+	UpsertCounterQuery = `
+		WITH upserted AS (
+			INSERT INTO counters (name, value)
+			VALUES ($1, $2)
+			ON CONFLICT (name) DO UPDATE SET value = counters.value + EXCLUDED.value, updated_at = now()
+			RETURNING name, value
+		)
+		INSERT INTO samples (name, type, value)
+		SELECT name, 'counter', value FROM upserted
+	`
+	// CumulativeCounterQuery adds the increase of the source value since the last write.
+	// A source value that went down is a reset, so all of it is new. Counters without
+	// a source value yet use the stored value as the baseline.
+	CumulativeCounterQuery = `
+		WITH upserted AS (
+			INSERT INTO counters (name, value, source_value)
+			VALUES ($1, $2, $2)
+			ON CONFLICT (name) DO UPDATE SET
+				value = counters.value + CASE
+					WHEN EXCLUDED.source_value >= COALESCE(counters.source_value, counters.value)
+					THEN EXCLUDED.source_value - COALESCE(counters.source_value, counters.value)
+					ELSE EXCLUDED.source_value
+				END,
+				source_value = EXCLUDED.source_value,
+				updated_at = now()
+			RETURNING name, value
+		)
+		INSERT INTO samples (name, type, value)
+		SELECT name, 'counter', value FROM upserted
+	`
+	UpsertHistogramQuery = `
+		WITH upserted AS (
+			INSERT INTO histograms (name, value)
+			VALUES ($1, $2)
+			ON CONFLICT (name) DO UPDATE SET value = EXCLUDED.value, updated_at = now()
+			RETURNING name
+		)
+		INSERT INTO samples (name, type, value)
+		SELECT name, 'histogram', $3::DOUBLE PRECISION FROM upserted
+	`
+	UpsertSummaryQuery = `
+		WITH upserted AS (
+			INSERT INTO summaries (name, value)
+			VALUES ($1, $2)
+			ON CONFLICT (name) DO UPDATE SET value = EXCLUDED.value, updated_at = now()
+			RETURNING name
+		)
+		INSERT INTO samples (name, type, value)
+		SELECT name, 'summary', $3::DOUBLE PRECISION FROM upserted
+	`
 )
 
 type PostgresStorage struct {
@@ -19,58 +88,20 @@ func NewPostgresStorageFromDB(ctx context.Context, db *sql.DB) (*PostgresStorage
 		return nil, fmt.Errorf("database connection is nil")
 	}
 
-	if err := createTables(ctx, db); err != nil {
-		return nil, fmt.Errorf("failed to create tables: %w", err)
+	if err := MigrateUp(ctx, db, 0); err != nil {
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
 	return &PostgresStorage{DB: db}, nil
 }
 
-func createTables(ctx context.Context, db *sql.DB) error {
-	tx, err := db.BeginTx(ctx, nil)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-
-	_, err = tx.ExecContext(ctx, `
-		CREATE TABLE IF NOT EXISTS gauges (
-			name TEXT PRIMARY KEY,
-			value DOUBLE PRECISION NOT NULL
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("failed to create gauges table: %w", err)
-	}
-
-	_, err = tx.ExecContext(ctx, `
-		CREATE TABLE IF NOT EXISTS counters (
-			name TEXT PRIMARY KEY,
-			value BIGINT NOT NULL
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("failed to create counters table: %w", err)
-	}
-
-	return tx.Commit()
-}
-
 func (p *PostgresStorage) SetGauge(ctx context.Context, name string, value float64) error {
-	_, err := p.DB.ExecContext(ctx, `
-		INSERT INTO gauges (name, value)
-		VALUES ($1, $2)
-		ON CONFLICT (name) DO UPDATE SET value = EXCLUDED.value
-	`, name, value)
+	_, err := p.DB.ExecContext(ctx, UpsertGaugeQuery, name, value)
 	return err
 }
 
 func (p *PostgresStorage) AddCounter(ctx context.Context, name string, value int64) error {
-	_, err := p.DB.ExecContext(ctx, `
-		INSERT INTO counters (name, value)
-		VALUES ($1, $2)
-		ON CONFLICT (name) DO UPDATE SET value = counters.value + EXCLUDED.value
-	`, name, value)
+	_, err := p.DB.ExecContext(ctx, UpsertCounterQuery, name, value)
 	return err
 }
 
@@ -147,6 +178,381 @@ func (p *PostgresStorage) Counters(ctx context.Context) (map[string]int64, error
 	}
 	return counters, nil
 }
+
+func (p *PostgresStorage) AddHistogram(ctx context.Context, name string, value models.HistogramValue) error {
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := AddHistogramTx(ctx, tx, name, value); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AddHistogramTx merges value into the stored histogram. The read-modify-write is serialized
+// per series with a transaction-scoped advisory lock, so it also covers the first insert.
+func AddHistogramTx(ctx context.Context, tx *sql.Tx, name string, value models.HistogramValue) error {
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, "histogram:"+name); err != nil {
+		return err
+	}
+
+	merged := value.Clone()
+	var raw []byte
+	err := tx.QueryRowContext(ctx, `SELECT value FROM histograms WHERE name = $1`, name).Scan(&raw)
+	switch {
+	case err == nil:
+		var current models.HistogramValue
+		if err := json.Unmarshal(raw, &current); err != nil {
+			return fmt.Errorf("decode stored histogram: %w", err)
+		}
+		current.Merge(value)
+		merged = current
+	case !errors.Is(err, sql.ErrNoRows):
+		return err
+	}
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, UpsertHistogramQuery, name, string(data), float64(merged.Count))
+	return err
+}
+
+func (p *PostgresStorage) GetHistogram(ctx context.Context, name string) (*models.HistogramValue, error) {
+	var value models.HistogramValue
+	if err := p.getJSON(ctx, "histograms", name, &value); err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
+
+func (p *PostgresStorage) Histograms(ctx context.Context) (map[string]models.HistogramValue, error) {
+	histograms := make(map[string]models.HistogramValue)
+	err := p.listJSON(ctx, "histograms", func(name string, raw []byte) error {
+		var value models.HistogramValue
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return err
+		}
+		histograms[name] = value
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return histograms, nil
+}
+
+func (p *PostgresStorage) SetSummary(ctx context.Context, name string, value models.SummaryValue) error {
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := SetSummaryTx(ctx, tx, name, value); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func SetSummaryTx(ctx context.Context, tx *sql.Tx, name string, value models.SummaryValue) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, UpsertSummaryQuery, name, string(data), float64(value.Count))
+	return err
+}
+
+func (p *PostgresStorage) GetSummary(ctx context.Context, name string) (*models.SummaryValue, error) {
+	var value models.SummaryValue
+	if err := p.getJSON(ctx, "summaries", name, &value); err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
+
+func (p *PostgresStorage) Summaries(ctx context.Context) (map[string]models.SummaryValue, error) {
+	summaries := make(map[string]models.SummaryValue)
+	err := p.listJSON(ctx, "summaries", func(name string, raw []byte) error {
+		var value models.SummaryValue
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return err
+		}
+		summaries[name] = value
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
+
+func (p *PostgresStorage) getJSON(ctx context.Context, table, name string, value interface{}) error {
+	var raw []byte
+	err := p.DB.QueryRowContext(ctx, "SELECT value FROM "+table+" WHERE name = $1", name).Scan(&raw)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, value)
+}
+
+func (p *PostgresStorage) listJSON(ctx context.Context, table string, fn func(name string, raw []byte) error) error {
+	rows, err := p.DB.QueryContext(ctx, "SELECT name, value FROM "+table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var raw []byte
+		if err := rows.Scan(&name, &raw); err != nil {
+			return err
+		}
+		if err := fn(name, raw); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (p *PostgresStorage) Samples(ctx context.Context, mType, name string, from, to time.Time) ([]models.Sample, error) {
+	rows, err := p.DB.QueryContext(ctx, `
+		SELECT ts, value FROM samples
+		WHERE type = $1 AND name = $2 AND ts BETWEEN $3 AND $4
+		ORDER BY ts
+	`, mType, name, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	samples := make([]models.Sample, 0)
+	for rows.Next() {
+		var sample models.Sample
+		if err := rows.Scan(&sample.Timestamp, &sample.Value); err != nil {
+			return nil, err
+		}
+		samples = append(samples, sample)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return samples, nil
+}
+
+func (p *PostgresStorage) DeleteGauge(ctx context.Context, name string) error {
+	return p.deleteOne(ctx, models.Gauge, name)
+}
+
+func (p *PostgresStorage) DeleteCounter(ctx context.Context, name string) error {
+	return p.deleteOne(ctx, models.Counter, name)
+}
+
+func (p *PostgresStorage) DeleteHistogram(ctx context.Context, name string) error {
+	return p.deleteOne(ctx, models.Histogram, name)
+}
+
+func (p *PostgresStorage) DeleteSummary(ctx context.Context, name string) error {
+	return p.deleteOne(ctx, models.Summary, name)
+}
+
+func (p *PostgresStorage) deleteOne(ctx context.Context, mType, name string) error {
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	deleted, err := deleteSeries(ctx, tx, mType, []string{name})
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+func (p *PostgresStorage) ResetCounter(ctx context.Context, name string) error {
+	result, err := p.DB.ExecContext(ctx, `
+		WITH reset AS (
+			UPDATE counters SET value = 0, updated_at = now() WHERE name = $1
+			RETURNING name, value
+		)
+		INSERT INTO samples (name, type, value)
+		SELECT name, 'counter', value FROM reset
+	`, name)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteMetrics deletes all matching series in one transaction. Prefix and
+// labels are prefiltered in SQL, the exact match is checked on the parsed key.
+func (p *PostgresStorage) DeleteMetrics(ctx context.Context, filter DeleteFilter) (int, error) {
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	deleted := 0
+	for _, mType := range seriesTypes {
+		if filter.Type != "" && filter.Type != mType {
+			continue
+		}
+		names, err := matchingSeries(ctx, tx, mType, filter)
+		if err != nil {
+			return 0, err
+		}
+		if len(names) == 0 {
+			continue
+		}
+		n, err := deleteSeries(ctx, tx, mType, names)
+		if err != nil {
+			return 0, err
+		}
+		deleted += n
+	}
+	return deleted, tx.Commit()
+}
+
+func matchingSeries(ctx context.Context, tx *sql.Tx, mType string, filter DeleteFilter) ([]string, error) {
+	patterns := []string{escapeLike(filter.Prefix) + "%"}
+	for k, v := range filter.Labels {
+		patterns = append(patterns, "%"+escapeLike(k+"="+strconv.Quote(v))+"%")
+	}
+	rows, err := tx.QueryContext(ctx, "SELECT name FROM "+seriesTable(mType)+" WHERE name LIKE ALL($1) FOR UPDATE", pq.Array(patterns))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		if filter.Match(mType, name) {
+			names = append(names, name)
+		}
+	}
+	return names, rows.Err()
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+var seriesTypes = []string{models.Gauge, models.Counter, models.Histogram, models.Summary}
+
+func seriesTable(mType string) string {
+	switch mType {
+	case models.Counter:
+		return "counters"
+	case models.Histogram:
+		return "histograms"
+	case models.Summary:
+		return "summaries"
+	default:
+		return "gauges"
+	}
+}
+
+func deleteSeries(ctx context.Context, tx *sql.Tx, mType string, names []string) (int, error) {
+	result, err := tx.ExecContext(ctx, "DELETE FROM "+seriesTable(mType)+" WHERE name = ANY($1)", pq.Array(names))
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM samples WHERE type = $1 AND name = ANY($2)", mType, pq.Array(names)); err != nil {
+		return 0, err
+	}
+	return int(deleted), nil
+}
+
+func (p *PostgresStorage) LastUpdated(ctx context.Context, mType, name string) (time.Time, error) {
+	var updated time.Time
+	err := p.DB.QueryRowContext(ctx, "SELECT updated_at FROM "+seriesTable(mType)+" WHERE name = $1", name).Scan(&updated)
+	return updated, err
+}
+
+func (p *PostgresStorage) UpdateTimes(ctx context.Context, mType string) (map[string]time.Time, error) {
+	rows, err := p.DB.QueryContext(ctx, "SELECT name, updated_at FROM "+seriesTable(mType))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	times := make(map[string]time.Time)
+	for rows.Next() {
+		var name string
+		var updated time.Time
+		if err := rows.Scan(&name, &updated); err != nil {
+			return nil, err
+		}
+		times[name] = updated
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return times, nil
+}
+
+func (p *PostgresStorage) ExpireSeries(ctx context.Context, before time.Time) (int, error) {
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	expired := 0
+	for _, mType := range seriesTypes {
+		var n int
+		err := tx.QueryRowContext(ctx, `
+			WITH expired AS (
+				DELETE FROM `+seriesTable(mType)+` WHERE updated_at < $1
+				RETURNING name
+			), purged AS (
+				DELETE FROM samples WHERE type = $2 AND name IN (SELECT name FROM expired)
+			)
+			SELECT count(*) FROM expired
+		`, before, mType).Scan(&n)
+		if err != nil {
+			return 0, err
+		}
+		expired += n
+	}
+	return expired, tx.Commit()
+}
+
+func (p *PostgresStorage) PruneSamples(ctx context.Context, before time.Time) (int, error) {
+	result, err := p.DB.ExecContext(ctx, `DELETE FROM samples WHERE ts < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	pruned, err := result.RowsAffected()
+	return int(pruned), err
+}
+
 func (p *PostgresStorage) Save() error {
 	return nil
 }
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/alisaviation/monitoring/internal/models"
+)
+
+const DefaultHistorySize = 3600
+
+// ringBuffer grows on demand up to capacity and only wraps once it is full, so
+// series with few samples do not allocate the whole history up front.
+type ringBuffer struct {
+	samples  []models.Sample
+	start    int
+	size     int
+	capacity int
+}
+
+func newRingBuffer(capacity int) *ringBuffer {
+	if capacity <= 0 {
+		capacity = DefaultHistorySize
+	}
+	return &ringBuffer{capacity: capacity}
+}
+
+func (b *ringBuffer) add(sample models.Sample) {
+	if len(b.samples) < b.capacity {
+		b.samples = append(b.samples, sample)
+		b.size++
+		return
+	}
+	b.samples[b.start] = sample
+	b.start = (b.start + 1) % len(b.samples)
+}
+
+// dropBefore removes samples older than before and compacts what is left.
+func (b *ringBuffer) dropBefore(before time.Time) int {
+	kept := make([]models.Sample, 0, b.size)
+	for i := 0; i < b.size; i++ {
+		sample := b.samples[(b.start+i)%len(b.samples)]
+		if !sample.Timestamp.Before(before) {
+			kept = append(kept, sample)
+		}
+	}
+	dropped := b.size - len(kept)
+	if dropped > 0 {
+		b.samples, b.start, b.size = kept, 0, len(kept)
+	}
+	return dropped
+}
+
+func (b *ringBuffer) rangeSamples(from, to time.Time) []models.Sample {
+	result := make([]models.Sample, 0)
+	capacity := len(b.samples)
+	for i := 0; i < b.size; i++ {
+		sample := b.samples[(b.start+i)%capacity]
+		if sample.Timestamp.Before(from) || sample.Timestamp.After(to) {
+			continue
+		}
+		result = append(result, sample)
+	}
+	return result
+}
@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/alisaviation/monitoring/internal/logger"
+	"github.com/alisaviation/monitoring/internal/models"
+)
+
+const DefaultSnapshotRetention = 3
+
+var ErrSnapshotChecksum = errors.New("snapshot checksum mismatch")
+
+type snapshot struct {
+	Gauges     map[string]float64               `json:"gauges"`
+	Counters   map[string]int64                 `json:"counters"`
+	Histograms map[string]models.HistogramValue `json:"histograms,omitempty"`
+	Summaries  map[string]models.SummaryValue   `json:"summaries,omitempty"`
+	Updated    map[string]time.Time             `json:"updated,omitempty"`
+	Checksum   string                           `json:"checksum,omitempty"`
+}
+
+func (s snapshot) computeChecksum() (string, error) {
+	payload, err := json.Marshal(snapshot{
+		Gauges:     s.Gauges,
+		Counters:   s.Counters,
+		Histograms: s.Histograms,
+		Summaries:  s.Summaries,
+		Updated:    s.Updated,
+	})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func rotatedSnapshotPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+func writeSnapshot(path string, keep int, data snapshot) error {
+	checksum, err := data.computeChecksum()
+	if err != nil {
+		return err
+	}
+	data.Checksum = checksum
+
+	jsonData, err := json.MarshalIndent(data, "", "    ")
+	if err != nil {
+		return err
+	}
+	jsonData = append(jsonData, '\n')
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(jsonData); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := rotateSnapshots(path, keep); err != nil {
+		return fmt.Errorf("rotate snapshots: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// rotateSnapshots keeps the current snapshot in place and links it to path.1, so a
+// crash before the new snapshot is renamed over path never leaves path missing.
+func rotateSnapshots(path string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	for i := keep - 1; i >= 1; i-- {
+		err := os.Rename(rotatedSnapshotPath(path, i), rotatedSnapshotPath(path, i+1))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	rotated := rotatedSnapshotPath(path, 1)
+	if err := os.Remove(rotated); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.Link(path, rotated); err == nil {
+		return nil
+	}
+	return copyFile(path, rotated)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func readSnapshot(path string) (snapshot, error) {
+	var data snapshot
+	file, err := os.Open(path)
+	if err != nil {
+		return data, err
+	}
+	defer file.Close()
+
+	if err := json.NewDecoder(file).Decode(&data); err != nil {
+		return data, err
+	}
+	if data.Checksum == "" {
+		logger.Log.Warn("Loading snapshot without checksum, its integrity cannot be verified", zap.String("path", path))
+	} else {
+		checksum, err := data.computeChecksum()
+		if err != nil {
+			return data, err
+		}
+		if checksum != data.Checksum {
+			return data, ErrSnapshotChecksum
+		}
+	}
+	return data, nil
+}
+
+func readNewestSnapshot(path string, keep int) (snapshot, string, error) {
+	data, firstErr := readSnapshot(path)
+	if firstErr == nil {
+		return data, path, nil
+	}
+	for i := 1; i <= keep; i++ {
+		rotated := rotatedSnapshotPath(path, i)
+		if data, err := readSnapshot(rotated); err == nil {
+			return data, rotated, nil
+		}
+	}
+	return snapshot{}, "", firstErr
+}
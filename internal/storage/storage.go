@@ -2,6 +2,10 @@ package storage
 
 import (
 	"context"
+	"strings"
+	"time"
+
+	"github.com/alisaviation/monitoring/internal/models"
 )
 
 type Storage interface {
@@ -11,6 +15,37 @@ type Storage interface {
 	GetCounter(ctx context.Context, name string) (*int64, error)
 	Gauges(ctx context.Context) (map[string]float64, error)
 	Counters(ctx context.Context) (map[string]int64, error)
+	AddHistogram(ctx context.Context, name string, value models.HistogramValue) error
+	GetHistogram(ctx context.Context, name string) (*models.HistogramValue, error)
+	Histograms(ctx context.Context) (map[string]models.HistogramValue, error)
+	SetSummary(ctx context.Context, name string, value models.SummaryValue) error
+	GetSummary(ctx context.Context, name string) (*models.SummaryValue, error)
+	Summaries(ctx context.Context) (map[string]models.SummaryValue, error)
+	Samples(ctx context.Context, mType, name string, from, to time.Time) ([]models.Sample, error)
+	DeleteGauge(ctx context.Context, name string) error
+	DeleteCounter(ctx context.Context, name string) error
+	DeleteHistogram(ctx context.Context, name string) error
+	DeleteSummary(ctx context.Context, name string) error
+	ResetCounter(ctx context.Context, name string) error
+	DeleteMetrics(ctx context.Context, filter DeleteFilter) (int, error)
+	LastUpdated(ctx context.Context, mType, name string) (time.Time, error)
+	UpdateTimes(ctx context.Context, mType string) (map[string]time.Time, error)
+	ExpireSeries(ctx context.Context, before time.Time) (int, error)
+	PruneSamples(ctx context.Context, before time.Time) (int, error)
 	Save() error
 	IsUniqueViolationError(err error) bool
 }
+
+type DeleteFilter struct {
+	Type   string            `json:"type,omitempty"`
+	Prefix string            `json:"prefix,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+func (f DeleteFilter) Match(mType, name string) bool {
+	if f.Type != "" && f.Type != mType {
+		return false
+	}
+	id, labels := models.ParseSeriesKey(name)
+	return strings.HasPrefix(id, f.Prefix) && models.MatchLabels(labels, f.Labels)
+}
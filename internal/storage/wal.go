@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/alisaviation/monitoring/internal/models"
+)
+
+const (
+	walOpDelete = "delete"
+	walOpReset  = "reset"
+)
+
+type walEntry struct {
+	Op    string  `json:"op,omitempty"`
+	Type  string  `json:"type"`
+	Name  string  `json:"name"`
+	Value float64 `json:"value,omitempty"`
+	Delta int64   `json:"delta,omitempty"`
+	TS    int64   `json:"ts,omitempty"`
+
+	Histogram *models.HistogramValue `json:"histogram,omitempty"`
+	Summary   *models.SummaryValue   `json:"summary,omitempty"`
+}
+
+type wal struct {
+	path string
+	file *os.File
+}
+
+func openWAL(path string) (*wal, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open wal: %w", err)
+	}
+	return &wal{path: path, file: file}, nil
+}
+
+func (w *wal) append(entry walEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if _, err := w.file.Write(data); err != nil {
+		return fmt.Errorf("write wal: %w", err)
+	}
+	return w.file.Sync()
+}
+
+func (w *wal) truncate(size int64) error {
+	if err := w.file.Truncate(size); err != nil {
+		return fmt.Errorf("truncate wal: %w", err)
+	}
+	return w.file.Sync()
+}
+
+func (w *wal) close() error {
+	return w.file.Close()
+}
+
+// replayWAL applies entries up to the first incomplete or corrupt line and
+// returns the size of the intact prefix. The caller must truncate the log to
+// that size before appending, otherwise new entries would be glued to the
+// torn line and lost on the next replay.
+func replayWAL(path string, apply func(entry walEntry)) (int, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	applied := 0
+	var size int64
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return applied, size, nil
+		}
+		if err != nil {
+			return applied, size, err
+		}
+		var entry walEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return applied, size, nil
+		}
+		apply(entry)
+		applied++
+		size += int64(len(line))
+	}
+}